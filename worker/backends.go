@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// FEATURE: PLUGGABLE PROVIDER-SPECIFIC VERIFICATION BACKENDS
+// ============================================================
+// Some large mail providers either block SMTP RCPT probes outright or
+// return misleading 250s, making a generic SMTP-only probe unreliable.
+// A VerifierBackend lets a specific MX host opt out of the generic SMTP
+// conversation in CheckEmail in favor of a provider-tuned strategy.
+
+// VerifierBackend is a provider-specific verification strategy, selected
+// by the MX hostname CheckEmail resolved for the target domain.
+type VerifierBackend interface {
+	// Supports reports whether this backend should handle mxHost instead
+	// of the generic SMTP conversation.
+	Supports(mxHost string) bool
+	// Check performs the provider-specific verification for email.
+	Check(ctx context.Context, email string) (*SMTPResult, error)
+}
+
+// backendRegistry holds the registered provider backends, consulted in
+// registration order. CheckEmail dispatches to the first backend whose
+// Supports() claims the resolved MX host; if none claim it, CheckEmail
+// falls through to the generic SMTP conversation.
+var backendRegistry []VerifierBackend
+
+func init() {
+	RegisterBackend(&GmailBackend{})
+	// OutlookBackend and YahooBackend are not registered: their Check is a
+	// stub that errors, and CheckEmail turns a backend error into a
+	// terminal UNKNOWN - registering them would make every M365/Yahoo
+	// address unverifiable. Register them once they have a real
+	// implementation (see their doc comments).
+}
+
+// RegisterBackend adds a VerifierBackend to the registry.
+func RegisterBackend(backend VerifierBackend) {
+	backendRegistry = append(backendRegistry, backend)
+}
+
+// findBackend returns the first registered backend claiming mxHost, or nil
+// if none do (generic SMTP should be used).
+func findBackend(mxHost string) VerifierBackend {
+	for _, backend := range backendRegistry {
+		if backend.Supports(mxHost) {
+			return backend
+		}
+	}
+	return nil
+}
+
+// gmailCommandPacing is the extra delay GmailBackend waits before opening
+// its SMTP conversation. Gmail throttles bursty RCPT probing harder than
+// it throttles evenly-paced traffic.
+const gmailCommandPacing = 500 * time.Millisecond
+
+// GmailBackend talks to Gmail's MX hosts (aspmx.l.google.com and its
+// regional siblings) using the same SMTP conversation as the generic
+// path, but with extra pacing and explicit handling of Gmail's "252 2.1.5
+// Send some email" response, which GetSMTPCodeInfo treats as a generic
+// catch-all indicator but which Gmail returns for ordinary mailboxes it
+// simply declines to VRFY.
+type GmailBackend struct{}
+
+// Supports matches Google's MX hosts (*.l.google.com, aspmx.l.google.com).
+func (g *GmailBackend) Supports(mxHost string) bool {
+	mxHost = strings.ToLower(mxHost)
+	return strings.HasSuffix(mxHost, ".l.google.com") || strings.HasSuffix(mxHost, "smtp.google.com")
+}
+
+// Check resolves Gmail's MX host directly and runs the generic SMTP
+// conversation against it with added pacing, remapping 252 to VALID.
+func (g *GmailBackend) Check(ctx context.Context, email string) (*SMTPResult, error) {
+	parts := strings.Split(email, "@")
+	if len(parts) != 2 {
+		return &SMTPResult{
+			Status:       StatusInvalid,
+			SMTPCode:     550,
+			BounceReason: "Invalid email format",
+			IsRetryable:  false,
+		}, nil
+	}
+
+	mxRecords, err := net.LookupMX(parts[1])
+	if err != nil || len(mxRecords) == 0 {
+		return &SMTPResult{
+			Status:       StatusInvalid,
+			SMTPCode:     550,
+			BounceReason: "No MX records found",
+			IsRetryable:  false,
+		}, nil
+	}
+	sort.Slice(mxRecords, func(i, j int) bool { return mxRecords[i].Pref < mxRecords[j].Pref })
+	mailServer := strings.TrimSuffix(mxRecords[0].Host, ".")
+
+	// Gmail paces probes more harshly than it paces legitimate bursts of
+	// mail - give it breathing room before opening the conversation.
+	time.Sleep(gmailCommandPacing)
+
+	result, err := attemptSMTPHost(ctx, email, mailServer, "25", proxyConfig, workerHostname, false, tlsPolicy)
+	if err != nil || result == nil {
+		return result, err
+	}
+
+	if result.SMTPCode == 252 {
+		// Gmail: "I won't VRFY this, but I'll accept it for delivery" -
+		// for a live mailbox that's a pass, not a catch-all signal.
+		result.Status = StatusValid
+		result.IsRetryable = false
+	}
+
+	return result, nil
+}
+
+// OutlookBackend targets Microsoft 365 / Outlook.com MX hosts
+// (*.mail.protection.outlook.com). Microsoft's anti-abuse heuristics treat
+// raw SMTP RCPT probing as suspicious and frequently return a misleading
+// 250 regardless of whether the mailbox exists, so a real implementation
+// needs an API-backed check (e.g. Graph API) rather than a raw SMTP probe.
+// This is wired into the registry as a hook point; Check is a stub until
+// that API integration lands.
+type OutlookBackend struct {
+	// APIEndpoint will point at the verification API backing this backend
+	// once implemented.
+	APIEndpoint string
+}
+
+// Supports matches Microsoft's hosted-mailbox MX hosts.
+func (o *OutlookBackend) Supports(mxHost string) bool {
+	return strings.HasSuffix(strings.ToLower(mxHost), ".mail.protection.outlook.com")
+}
+
+// Check is not yet implemented - see OutlookBackend doc comment.
+func (o *OutlookBackend) Check(ctx context.Context, email string) (*SMTPResult, error) {
+	return nil, fmt.Errorf("outlook backend not implemented: raw SMTP probing against Outlook MX is unreliable, needs an API-backed verifier")
+}
+
+// YahooBackend targets Yahoo/AOL MX hosts (*.yahoodns.net), which are
+// known to return misleading 250s for RCPT probes and rate-limit
+// aggressively. Like OutlookBackend, a reliable implementation needs an
+// HTTP/API-backed check rather than raw SMTP; this is a registry hook
+// point until that lands.
+type YahooBackend struct {
+	// APIEndpoint will point at the verification API backing this backend
+	// once implemented.
+	APIEndpoint string
+}
+
+// Supports matches Yahoo/AOL's hosted-mailbox MX hosts.
+func (y *YahooBackend) Supports(mxHost string) bool {
+	return strings.HasSuffix(strings.ToLower(mxHost), ".yahoodns.net")
+}
+
+// Check is not yet implemented - see YahooBackend doc comment.
+func (y *YahooBackend) Check(ctx context.Context, email string) (*SMTPResult, error) {
+	return nil, fmt.Errorf("yahoo backend not implemented: raw SMTP probing against Yahoo MX is unreliable, needs an API-backed verifier")
+}
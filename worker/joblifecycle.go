@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ============================================================
+// FEATURE: PERSISTENT JOB STATE MACHINE WITH REAPER
+// ============================================================
+// A worker crashing (SIGKILL, OOM, network partition) between popping a job
+// and writing its final status used to lose the job silently: BRPOP already
+// removed it from email_queue and nothing else remembered it existed. The
+// fix is the classic reliable-queue pattern: a job is never allowed to sit
+// in neither structure. reserveJobScript moves a job from email_queue into
+// a per-worker inflight ZSET atomically, and Reaper sweeps that ZSET for
+// entries that have sat unconfirmed past jobVisibilityTimeout.
+//
+// Note on "atomic BRPOP->ZADD": Redis can't block inside a Lua script (EVAL
+// runs to completion before anything else touches the keyspace), so the
+// hand-off script does a non-blocking RPOP+ZADD instead of wrapping BRPOP.
+// The main loop polls it on an interval when the queue is empty. This keeps
+// the invariant the reaper depends on - a job is in email_queue or in an
+// inflight ZSET, never in transit between the two - without needing Redis
+// to block mid-script.
+
+const (
+	// inflightKeyPrefix namespaces the per-worker inflight ZSETs so Reaper
+	// can find all of them with a single SCAN pattern.
+	inflightKeyPrefix = "email_inflight:"
+
+	// jobVisibilityTimeout is how long a job may sit in an inflight ZSET
+	// without being completed before Reaper considers its worker dead and
+	// reclaims it.
+	jobVisibilityTimeout = 120 * time.Second
+
+	// reaperInterval is how often Reaper sweeps every inflight ZSET.
+	reaperInterval = 30 * time.Second
+
+	// maxJobAttempts caps a job's Attempt count (its reservations): a stale
+	// inflight job whose Attempt has reached it is not requeued, and Reaper
+	// writes a terminal UNKNOWN/reaped status instead.
+	maxJobAttempts = 5
+)
+
+// reserveJobScript atomically pops the oldest job off the first non-empty
+// of KEYS[1..#KEYS-1] (checked in order, so callers pass priority queue
+// keys high to low) and records it in KEYS[#KEYS] (inflightKey) with a
+// pickedUpAt/attempt-stamped payload. Returns the stamped job JSON, or
+// false if every queue was empty.
+//
+// This is a non-blocking RPOP rather than the BRPOP a priority pop across
+// multiple lists would naturally use: Redis can't block inside a Lua
+// script (EVAL runs to completion before anything else touches the
+// keyspace, same reason the single-queue version predating priority tiers
+// used RPOP), so the main loop polls this on an interval instead.
+var reserveJobScript = redis.NewScript(`
+	local inflightKey = KEYS[#KEYS]
+	local raw = nil
+	for i = 1, #KEYS - 1 do
+		raw = redis.call('RPOP', KEYS[i])
+		if raw then break end
+	end
+	if not raw then
+		return false
+	end
+	local job = cjson.decode(raw)
+	job.pickedUpAt = tonumber(ARGV[1])
+	job.attempt = (job.attempt or 0) + 1
+	local stamped = cjson.encode(job)
+	redis.call('ZADD', inflightKey, ARGV[1], stamped)
+	return stamped
+`)
+
+// reapRequeueScript atomically moves a stale member out of an inflight ZSET
+// and back onto the main queue, carrying the re-marshalled payload
+// (pickedUpAt cleared; attempt is incremented again by reserveJobScript on
+// the next pickup). It no-ops if the member was already removed (e.g. the worker
+// finished it between Reaper's ZRangeByScore and this call).
+var reapRequeueScript = redis.NewScript(`
+	local removed = redis.call('ZREM', KEYS[1], ARGV[1])
+	if removed == 1 then
+		redis.call('LPUSH', KEYS[2], ARGV[2])
+	end
+	return removed
+`)
+
+// inflightKeyFor returns the per-worker inflight ZSET key for hostname.
+func inflightKeyFor(hostname string) string {
+	return inflightKeyPrefix + hostname
+}
+
+// reserveJob pops the next job from the first non-empty of queueKeys (high
+// to low priority) into inflightKey via reserveJobScript, returning the
+// decoded job and the exact raw JSON string it was stamped with (the ZSET
+// member identity, needed to remove it on completion). A nil job with a
+// nil error means every queue was empty. This is ListQueue's Reserve,
+// factored out so Reaper can share the same inflight bookkeeping.
+func reserveJob(ctx context.Context, rdb *redis.Client, queueKeys []string, inflightKey string) (*EmailJob, string, error) {
+	res, err := reserveJobScript.Run(ctx, rdb, append(append([]string{}, queueKeys...), inflightKey), time.Now().Unix()).Result()
+	if err == redis.Nil {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	raw, ok := res.(string)
+	if !ok {
+		// Lua's `false` (empty queue) already came back as redis.Nil above,
+		// so anything other than a string here is a bug worth surfacing.
+		return nil, "", fmt.Errorf("reserveJobScript: unexpected result type %T", res)
+	}
+
+	var job EmailJob
+	if err := json.Unmarshal([]byte(raw), &job); err != nil {
+		return nil, "", fmt.Errorf("reserveJobScript: failed to decode stamped job: %v", err)
+	}
+
+	return &job, raw, nil
+}
+
+// completeInflightJob removes raw from inflightKey once a worker has
+// durably recorded its outcome (DB write or retry-queue enqueue). Best
+// effort: if this fails, Reaper will eventually reclaim and retry the job,
+// which is a safer failure mode than losing it.
+func completeInflightJob(ctx context.Context, inflightKey, raw string) {
+	if err := redisClient.ZRem(ctx, inflightKey, raw).Err(); err != nil {
+		log.Printf("⚠️  Failed to remove completed job from %s: %v", inflightKey, err)
+	}
+}
+
+// Reaper runs in a separate goroutine and reclaims jobs left behind in
+// inflight ZSETs by workers that died (crash, OOM, network partition)
+// before recording a terminal outcome.
+func Reaper(ctx context.Context) {
+	ticker := time.NewTicker(reaperInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reapStaleJobs(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reapStaleJobs scans every email_inflight:* key and reclaims entries older
+// than jobVisibilityTimeout.
+func reapStaleJobs(ctx context.Context) {
+	cutoff := time.Now().Add(-jobVisibilityTimeout).Unix()
+
+	var cursor uint64
+	for {
+		keys, next, err := redisClient.Scan(ctx, cursor, inflightKeyPrefix+"*", 100).Result()
+		if err != nil {
+			log.Printf("⚠️  Reaper: SCAN failed: %v", err)
+			return
+		}
+
+		for _, key := range keys {
+			reapInflightKey(ctx, key, cutoff)
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return
+		}
+	}
+}
+
+// reapInflightKey reclaims every member of inflightKey whose pickup
+// timestamp is older than cutoff: requeued if under maxJobAttempts,
+// otherwise written to Postgres as a terminal UNKNOWN/reaped result.
+func reapInflightKey(ctx context.Context, inflightKey string, cutoff int64) {
+	members, err := redisClient.ZRangeByScore(ctx, inflightKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("%d", cutoff),
+	}).Result()
+	if err != nil {
+		log.Printf("⚠️  Reaper: failed to scan %s: %v", inflightKey, err)
+		return
+	}
+
+	for _, raw := range members {
+		var job EmailJob
+		if err := json.Unmarshal([]byte(raw), &job); err != nil {
+			log.Printf("⚠️  Reaper: dropping corrupt inflight entry in %s: %v", inflightKey, err)
+			redisClient.ZRem(ctx, inflightKey, raw)
+			continue
+		}
+
+		if job.Attempt >= maxJobAttempts {
+			log.Printf("☠️  Reaper: %s exceeded %d attempts, marking reaped", job.Email, maxJobAttempts)
+			if err := updateEmailStatus(job.JobID, job.Email, "UNKNOWN", 0, "reaped: exceeded max attempts after worker crash/timeout"); err != nil {
+				log.Printf("⚠️  Reaper: failed to write reaped status for %s: %v", job.Email, err)
+			}
+			redisClient.ZRem(ctx, inflightKey, raw)
+			continue
+		}
+
+		job.PickedUpAt = 0
+		requeued, err := json.Marshal(job)
+		if err != nil {
+			log.Printf("⚠️  Reaper: failed to re-marshal %s for requeue: %v", job.Email, err)
+			continue
+		}
+
+		queueKey := priorityQueueKeys[normalizePriority(job.Priority)]
+		removed, err := reapRequeueScript.Run(ctx, redisClient, []string{inflightKey, queueKey}, raw, string(requeued)).Int()
+		if err != nil {
+			log.Printf("⚠️  Reaper: failed to requeue %s: %v", job.Email, err)
+			continue
+		}
+		if removed == 1 {
+			log.Printf("🔁 Reaper: requeued %s (attempt %d) after visibility timeout", job.Email, job.Attempt)
+		}
+	}
+}
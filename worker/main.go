@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"log"
+	"math"
+	"math/rand"
+	"net/http"
 	"os"
 	"regexp"
 	"strings"
@@ -14,32 +16,80 @@ import (
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // EmailJob represents a job from Redis queue
 type EmailJob struct {
 	JobID string `json:"jobId"`
 	Email string `json:"email"`
+
+	// TenantID identifies which tenant/API key enqueued this job, for
+	// TenantQuotaManager's per-tenant quota enforcement. Empty for jobs
+	// enqueued before multi-tenant quotas existed - those are exempt.
+	TenantID string `json:"tenantId,omitempty"`
+	// Priority selects which of the three priority-tiered ready queues
+	// (email_queue:high/normal/low) this job is reserved from. Empty
+	// normalizes to PriorityNormal.
+	Priority string `json:"priority,omitempty"`
+	// TraceParent is the W3C traceparent header of the span active when
+	// this job was enqueued, so processEmail's root span continues that
+	// trace instead of starting an unrelated one. Empty for jobs enqueued
+	// by something not yet instrumented with OpenTelemetry.
+	TraceParent string `json:"traceParent,omitempty"`
+
+	// PickedUpAt and Attempt are stamped by reserveJobScript when a worker
+	// claims the job and are what Reaper uses to detect and reclaim jobs
+	// abandoned by a dead worker. Omitted from freshly-enqueued jobs.
+	PickedUpAt int64 `json:"pickedUpAt,omitempty"`
+	Attempt    int   `json:"attempt,omitempty"`
+
+	// RetryCount is how many times this job has been greylisted and
+	// rescheduled via the retry queue (see the greylisting retry logic in
+	// processEmail) - distinct from Attempt, which reserveJobScript
+	// increments on every list-backend reservation, including the
+	// re-reservation of a job after a greylist retry.
+	RetryCount int `json:"retryCount,omitempty"`
 }
 
 const (
 	workerCount        = 50
 	redisQueue         = "email_queue"
 	retryQueue         = "email_retry_queue" // Redis ZSET for greylisting retries
-	retryDelay         = 900                 // 15 minutes in seconds
 	retryCheckInterval = 30 * time.Second    // Check retry queue every 30 seconds
+
+	// defaultMaxGreylistRetries caps retry attempts for an SMTP code
+	// GetSMTPCodeInfo doesn't set an explicit MaxRetries for (its zero
+	// value would otherwise mean "retry forever").
+	defaultMaxGreylistRetries = 3
+
+	// defaultGreylistRetrySeconds is the base delay used when
+	// GetSMTPCodeInfo leaves RetryAfterSeconds unset (e.g. the generic
+	// 4xx/default-range fallback already sets 300, but a future code might
+	// not).
+	defaultGreylistRetrySeconds = 900 // 15 minutes
+
+	// greylistBackoffJitter is the +/- fraction of randomness added to
+	// each greylist retry delay, so a batch of jobs greylisted at the same
+	// moment don't all come due and re-hit the same MX host at once.
+	greylistBackoffJitter = 0.2
 )
 
 var (
-	isDevMode      bool
-	proxyConfig    *ProxyConfig
-	workerHostname string
-	rateLimiter    *RateLimiterManager
+	isDevMode        bool
+	proxyConfig      *ProxyConfig
+	workerHostname   string
+	rateLimiter      *RateLimiterManager
+	tlsPolicy        TLSPolicy
+	tenantQuota      *TenantQuotaManager
+	requireRDNSMatch bool
 )
 
 var (
 	redisClient *redis.Client
 	db          *sql.DB
+	jobQueue    Queue
 )
 
 func main() {
@@ -107,6 +157,27 @@ func main() {
 
 	fmt.Printf("🆔 Worker Hostname: %s\n", workerHostname)
 
+	// ============================================================
+	// FEATURE: TLS POLICY CONFIGURATION (STARTTLS)
+	// ============================================================
+	if os.Getenv("REQUIRE_TLS") == "true" {
+		tlsPolicy = TLSRequired
+		fmt.Println("🔒 TLS policy: REQUIRED (fail closed if STARTTLS unavailable)")
+	} else {
+		tlsPolicy = TLSOpportunistic
+		fmt.Println("🔓 TLS policy: opportunistic (upgrade when advertised, fall back to plaintext)")
+	}
+
+	// requireRDNSMatch gates the reputation pre-flight's rDNS/HELO mismatch
+	// check (see CheckEmail in smtp.go). It defaults to off: in most real
+	// deployments (NAT, Kubernetes pod names, shared egress IPs) the egress
+	// IP's reverse DNS legitimately won't equal WORKER_HOSTNAME, so treating
+	// a mismatch as disqualifying by default fails every check closed.
+	requireRDNSMatch = os.Getenv("REQUIRE_RDNS_MATCH") == "true"
+	if requireRDNSMatch {
+		fmt.Println("🔎 Reputation pre-flight: rDNS/HELO mismatch required (fail closed on mismatch)")
+	}
+
 	// Get Redis configuration from env or use defaults
 	redisAddr := os.Getenv("REDIS_ADDR")
 	if redisAddr == "" {
@@ -125,13 +196,46 @@ func main() {
 		DB:       redisDB,
 	})
 
-	ctx := context.Background()
-	_, err := redisClient.Ping(ctx).Result()
+	ctx, cancel := context.WithCancel(context.Background())
+	installShutdownHandler(cancel)
+
+	// ============================================================
+	// FEATURE: OPENTELEMETRY TRACING
+	// ============================================================
+	shutdownTracing, err := initTracing(ctx, os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "email-validator-worker")
+	if err != nil {
+		log.Printf("⚠️  Failed to initialize OTel tracing, continuing without it: %v", err)
+		shutdownTracing = func(context.Context) error { return nil }
+	}
+	defer shutdownTracing(context.Background())
+
+	_, err = redisClient.Ping(ctx).Result()
 	if err != nil {
 		log.Fatalf("❌ Failed to connect to Redis: %v", err)
 	}
 	fmt.Println("✅ Connected to Redis")
 
+	// ============================================================
+	// FEATURE: ADAPTIVE RATE LIMITER PERSISTENCE + METRICS ENDPOINT
+	// ============================================================
+	rateLimiter.LoadFromRedis(ctx, redisClient)
+	go rateLimiter.RunPersistence(ctx, redisClient, rateLimitPersistInterval)
+
+	metricsPort := os.Getenv("METRICS_PORT")
+	if metricsPort == "" {
+		metricsPort = "9090"
+	}
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		rateLimiter.WriteMetrics(w)
+		metrics.WriteMetrics(w)
+	})
+	go func() {
+		if err := http.ListenAndServe(":"+metricsPort, nil); err != nil {
+			log.Printf("⚠️  Metrics server failed: %v", err)
+		}
+	}()
+	fmt.Printf("📊 Metrics endpoint listening on :%s/metrics\n", metricsPort)
+
 	// Connect to PostgreSQL
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
@@ -149,8 +253,33 @@ func main() {
 	}
 	fmt.Println("✅ Connected to PostgreSQL")
 
+	// ============================================================
+	// FEATURE: PLUGGABLE QUEUE BACKEND SELECTION
+	// ============================================================
+	queueBackend := os.Getenv("QUEUE_BACKEND")
+	if queueBackend == "" {
+		queueBackend = "list"
+	}
+	jobQueue = NewQueue(queueBackend, redisClient, workerHostname)
+	fmt.Printf("📦 Queue backend: %s\n", queueBackend)
+
+	// ============================================================
+	// FEATURE: PER-TENANT/API-KEY QUOTA MANAGER
+	// ============================================================
+	// Takes jobQueue (rather than talking to Redis lists directly) so a
+	// promoted throttled job is handed back through whichever backend is
+	// active - it's the only thing that knows where Reserve actually reads
+	// from.
+	tenantQuota = NewTenantQuotaManager(redisClient, db, jobQueue)
+	if err := tenantQuota.LoadQuotas(ctx); err != nil {
+		log.Printf("⚠️  TenantQuotaManager: initial quota load failed, falling back to defaults: %v", err)
+	}
+	go tenantQuota.RunRefresh(ctx, tenantQuotaRefreshInterval)
+	go tenantQuota.RunThrottleMonitor(ctx)
+	fmt.Println("🧮 Tenant quota manager started (refreshing from Postgres every", tenantQuotaRefreshInterval, ")")
+
 	// Create worker pool
-	jobChan := make(chan EmailJob, workerCount*2) // Buffer for jobs
+	jobChan := make(chan inflightJob, workerCount*2) // Buffer for jobs
 
 	// Start workers
 	for i := 0; i < workerCount; i++ {
@@ -158,129 +287,151 @@ func main() {
 	}
 
 	fmt.Printf("✅ Started %d workers\n", workerCount)
-	fmt.Println("📬 Listening for emails in queue:", redisQueue)
+	fmt.Println("📬 Listening for emails in priority queues:", priorityQueueKeys[PriorityHigh], priorityQueueKeys[PriorityNormal], priorityQueueKeys[PriorityLow])
 
 	// ============================================================
 	// FEATURE 2: START RETRY MONITOR GOROUTINE
 	// ============================================================
 	// Start the retry monitor in a separate goroutine
-	go RetryMonitor(ctx)
+	go RetryMonitor(ctx, jobQueue)
 	fmt.Println("🔄 Retry Monitor started (checking every 30 seconds)")
 
-	// Main loop: BRPOP from Redis queue
+	// ============================================================
+	// FEATURE: START REAPER GOROUTINE (STUCK IN-FLIGHT JOB RECOVERY)
+	// ============================================================
+	// Only the list backend needs this: the streams backend reclaims stale
+	// in-flight jobs itself via XAUTOCLAIM inside StreamQueue.Reserve.
+	if queueBackend != "streams" {
+		go Reaper(ctx)
+		fmt.Printf("🪦 Reaper started (sweeping %s* every %s)\n", inflightKeyPrefix, reaperInterval)
+	}
+
+	// Main loop: reserve jobs from the queue
+mainLoop:
 	for {
+		select {
+		case <-ctx.Done():
+			break mainLoop
+		default:
+		}
+
 		// ============================================================
 		// CRITICAL: GLOBAL RATE LIMIT ENFORCEMENT (Safety Valve)
 		// ============================================================
 		// BEFORE picking up ANY job, wait for global rate limiter
 		// This ensures we NEVER process more than 2 emails/second TOTAL
 		if err := rateLimiter.globalLimiter.Wait(ctx); err != nil {
+			if ctx.Err() != nil {
+				break mainLoop
+			}
 			log.Printf("⚠️  Global rate limit wait cancelled: %v", err)
 			continue
 		}
 
-		// BRPOP with 5 second timeout
-		result, err := redisClient.BRPop(ctx, 5*time.Second, redisQueue).Result()
+		// Reserve hands the job off into whatever in-flight tracking the
+		// backend uses (inflight ZSET for list, consumer-group PEL for
+		// streams) so a crash after this point can't lose it.
+		job, token, err := jobQueue.Reserve(ctx)
 		if err != nil {
-			if err == redis.Nil {
-				// Timeout - no jobs available, continue
-				continue
+			if ctx.Err() != nil {
+				break mainLoop
 			}
-			log.Printf("⚠️  Error reading from Redis: %v", err)
+			log.Printf("⚠️  Error reserving job from queue: %v", err)
 			time.Sleep(1 * time.Second)
 			continue
 		}
-
-		// Parse the job
-		if len(result) < 2 {
-			log.Printf("⚠️  Invalid queue result: %v", result)
+		if job == nil {
+			// Nothing available - brief pause before polling again.
+			time.Sleep(500 * time.Millisecond)
 			continue
 		}
 
-		var job EmailJob
-		err = json.Unmarshal([]byte(result[1]), &job)
-		if err != nil {
-			log.Printf("⚠️  Failed to parse job JSON: %v", err)
+		// ============================================================
+		// FEATURE: PER-TENANT/API-KEY QUOTA ENFORCEMENT
+		// ============================================================
+		// Checked before the job ever reaches a worker: a tenant over
+		// quota shouldn't consume a worker slot (or a domain rate-limit
+		// slot) just to be bounced right back.
+		if allowed, retryAfter, err := tenantQuota.Allow(ctx, job.TenantID); err != nil {
+			log.Printf("⚠️  Tenant quota check failed for %s, allowing job through: %v", job.TenantID, err)
+		} else if !allowed {
+			log.Printf("🚦 Tenant %s over quota, throttling %s for %s", job.TenantID, job.Email, retryAfter)
+			if err := tenantQuota.Throttle(ctx, job, retryAfter); err != nil {
+				log.Printf("⚠️  Failed to throttle over-quota job, requeuing immediately instead: %v", err)
+				jobQueue.Nack(ctx, token, 0)
+				continue
+			}
+			if err := jobQueue.Ack(ctx, token); err != nil {
+				log.Printf("⚠️  Failed to ack job handed off to tenant throttle queue: %v", err)
+			}
 			continue
 		}
 
+		// Track the job as dispatched before it ever reaches a worker, so
+		// a shutdown mid-send-to-channel still knows to requeue it.
+		workerWG.Add(1)
+		trackInflight(job.JobID, token)
+
 		// Send job to worker pool
 		select {
-		case jobChan <- job:
+		case jobChan <- inflightJob{Job: *job, Token: token}:
 			// Job sent successfully
 		default:
-			log.Printf("⚠️  Worker pool full, dropping job: %s", job.Email)
+			log.Printf("⚠️  Worker pool full, returning job to queue: %s", job.Email)
+			if err := jobQueue.Nack(ctx, token, 0); err != nil {
+				log.Printf("⚠️  Failed to return dropped job to queue: %v", err)
+			}
+			untrackInflight(job.JobID)
+			workerWG.Done()
 		}
 	}
+
+	// ============================================================
+	// FEATURE: GRACEFUL SHUTDOWN - DRAIN THEN REQUEUE STRANDED JOBS
+	// ============================================================
+	log.Println("🛑 Shutdown: draining in-flight jobs...")
+	gracePeriod := shutdownGracePeriod()
+	if drainWorkers(jobChan, gracePeriod) {
+		log.Println("✅ Shutdown: all in-flight jobs drained cleanly")
+	} else {
+		log.Printf("⚠️  Shutdown: grace period of %s expired with jobs still in-flight, requeuing", gracePeriod)
+		requeueStrandedJobs()
+	}
+	log.Println("👋 Worker exited")
 }
 
 // ============================================================
 // FEATURE 2: RETRY MONITOR (ZSET Pattern)
 // ============================================================
-// RetryMonitor runs in a separate goroutine and monitors the retry queue
-// It checks every 30 seconds for emails that are ready to be retried
-func RetryMonitor(ctx context.Context) {
+// RetryMonitor runs in a separate goroutine and promotes due retries back
+// into q's ready queue every retryCheckInterval. It works against any Queue
+// backend that implements retryPromoter (both ListQueue and StreamQueue do).
+func RetryMonitor(ctx context.Context, q Queue) {
+	promoter, ok := q.(retryPromoter)
+	if !ok {
+		log.Printf("⚠️  Retry Monitor: queue backend %T does not support retry promotion", q)
+		return
+	}
+
 	ticker := time.NewTicker(retryCheckInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			// Get current timestamp
-			now := time.Now().Unix()
-
-			// Get all items from ZSET with score <= now (ready to retry)
-			// ZRANGEBYSCORE email_retry_queue -inf now
-			items, err := redisClient.ZRangeByScore(ctx, retryQueue, &redis.ZRangeBy{
-				Min: "-inf",
-				Max: fmt.Sprintf("%d", now),
-			}).Result()
-
+			promoted, err := promoter.PromoteDueRetries(ctx)
 			if err != nil {
-				log.Printf("⚠️  Error reading retry queue: %v", err)
+				log.Printf("⚠️  Error promoting due retries: %v", err)
 				continue
 			}
-
-			if len(items) == 0 {
-				// No items ready for retry
-				continue
+			if promoted > 0 {
+				log.Printf("🔄 Promoted %d email(s) ready for retry", promoted)
 			}
 
-			log.Printf("🔄 Found %d email(s) ready for retry", len(items))
-
-			// Process each item
-			for _, itemJSON := range items {
-				// Parse the job
-				var job EmailJob
-				err := json.Unmarshal([]byte(itemJSON), &job)
-				if err != nil {
-					log.Printf("⚠️  Failed to parse retry job JSON: %v", err)
-					// Remove invalid item from ZSET
-					redisClient.ZRem(ctx, retryQueue, itemJSON)
-					continue
-				}
-
-				// Remove from retry queue (atomic operation)
-				removed, err := redisClient.ZRem(ctx, retryQueue, itemJSON).Result()
-				if err != nil || removed == 0 {
-					log.Printf("⚠️  Failed to remove item from retry queue: %v", err)
-					continue
-				}
-
-				// Push back to main queue for re-processing
-				jobJSON, _ := json.Marshal(job)
-				err = redisClient.LPush(ctx, redisQueue, string(jobJSON)).Err()
-				if err != nil {
-					log.Printf("⚠️  Failed to push retry job to queue: %v", err)
-					// Re-add to retry queue if push failed
-					redisClient.ZAdd(ctx, retryQueue, redis.Z{
-						Score:  float64(now + retryDelay),
-						Member: itemJSON,
-					})
-					continue
-				}
-
-				log.Printf("🔄 Retrying email: %s (Job: %s)", job.Email, job.JobID)
+			if depth, err := promoter.RetryQueueDepth(ctx); err != nil {
+				log.Printf("⚠️  Retry Monitor: failed to read retry_queue_depth: %v", err)
+			} else {
+				metrics.SetRetryQueueDepth(depth)
 			}
 
 		case <-ctx.Done():
@@ -289,101 +440,206 @@ func RetryMonitor(ctx context.Context) {
 	}
 }
 
+// maxGreylistRetries is how many times code may be retried before the
+// retry queue gives up and reports it terminal, per GetSMTPCodeInfo's
+// MaxRetries (falling back to defaultMaxGreylistRetries if it leaves
+// MaxRetries unset).
+func maxGreylistRetries(code int) int {
+	if info := GetSMTPCodeInfo(code); info != nil && info.MaxRetries > 0 {
+		return info.MaxRetries
+	}
+	return defaultMaxGreylistRetries
+}
+
+// greylistRetryDelay computes how long to wait before the retryCount'th
+// retry of code: GetSMTPCodeInfo's RetryAfterSeconds as a base, doubled per
+// prior attempt (exponential backoff) and jittered by +/-
+// greylistBackoffJitter so a batch of jobs greylisted together don't all
+// come due at once.
+func greylistRetryDelay(code int, retryCount int) time.Duration {
+	base := defaultGreylistRetrySeconds
+	if info := GetSMTPCodeInfo(code); info != nil && info.RetryAfterSeconds > 0 {
+		base = info.RetryAfterSeconds
+	}
+
+	seconds := float64(base) * math.Pow(2, float64(retryCount))
+	jitter := 1 + (rand.Float64()*2-1)*greylistBackoffJitter
+	return time.Duration(seconds*jitter) * time.Second
+}
+
 // worker processes email validation jobs
-func worker(id int, jobChan <-chan EmailJob, ctx context.Context) {
-	for job := range jobChan {
-		processEmail(id, job, ctx)
+func worker(id int, jobChan <-chan inflightJob, ctx context.Context) {
+	for envelope := range jobChan {
+		processEmail(id, envelope, ctx)
+		untrackInflight(envelope.Job.JobID)
+		workerWG.Done()
 	}
 }
 
 // processEmail performs SMTP check and updates database
 // Now includes rate limiting and proper proxy/hostname handling
-func processEmail(workerID int, job EmailJob, ctx context.Context) {
-	fmt.Printf("[Worker %d] 🔍 Checking: %s\n", workerID, job.Email)
+func processEmail(workerID int, envelope inflightJob, ctx context.Context) {
+	job := envelope.Job
+	token := envelope.Token
+
+	ctx = extractJobContext(ctx, job)
+	ctx, span := tracer.Start(ctx, "email.check", trace.WithAttributes(
+		attribute.String("job_id", job.JobID),
+		attribute.String("email", job.Email),
+		attribute.Int("worker_id", workerID),
+	))
+	defer span.End()
+
+	log := logger.With("worker_id", workerID, "job_id", job.JobID, "email", job.Email)
+	log.InfoContext(ctx, "checking email")
 
 	// ============================================================
 	// CRITICAL: EMAIL SYNTAX VALIDATION (RFC 5322 Compliant)
 	// ============================================================
 	// Validate email syntax BEFORE any processing
-	if !isValidEmailSyntax(job.Email) {
-		log.Printf("[Worker %d] ❌ Invalid email syntax: %s", workerID, job.Email)
+	_, syntaxSpan := tracer.Start(ctx, "email.validate_syntax")
+	valid := isValidEmailSyntax(job.Email)
+	syntaxSpan.End()
+	if !valid {
+		log.WarnContext(ctx, "invalid email syntax")
 		updateEmailStatus(job.JobID, job.Email, "INVALID", 550, "Invalid email syntax")
+		metrics.IncEmailsProcessed("INVALID", "")
+		ackJob(ctx, token)
 		return
 	}
 
 	// Extract domain for rate limiting
 	parts := strings.Split(job.Email, "@")
 	if len(parts) != 2 {
-		log.Printf("[Worker %d] ❌ Invalid email format: %s", workerID, job.Email)
+		log.WarnContext(ctx, "invalid email format")
 		updateEmailStatus(job.JobID, job.Email, "INVALID", 550, "Invalid email format")
+		metrics.IncEmailsProcessed("INVALID", "")
+		ackJob(ctx, token)
 		return
 	}
 	domain := strings.ToLower(parts[1])
+	log = log.With("domain", domain)
 
 	// ============================================================
 	// FEATURE 1: DOMAIN-SPECIFIC RATE LIMITING (The Governor)
 	// ============================================================
 	// Note: Global rate limit is already enforced in main loop
 	// This is for domain-specific limits only
-	if err := rateLimiter.Wait(ctx, domain); err != nil {
-		log.Printf("[Worker %d] ❌ Rate limit wait cancelled: %v", workerID, err)
+	if err := timeRateLimitWait(ctx, domain); err != nil {
+		log.WarnContext(ctx, "rate limit wait cancelled", "error", err)
 		return
 	}
 
+	// ============================================================
+	// FEATURE: MAX_INFLIGHT_PER_DOMAIN SEMAPHORE
+	// ============================================================
+	// The token bucket caps throughput; this caps concurrency, since some
+	// providers trip their abuse heuristics on parallelism just as much.
+	release, err := rateLimiter.AcquireInflight(ctx, domain)
+	if err != nil {
+		log.WarnContext(ctx, "inflight slot wait cancelled", "error", err)
+		return
+	}
+	defer release()
+
 	// Perform SMTP check (with proxy config and worker hostname)
-	result, err := CheckEmail(ctx, job.Email, isDevMode, proxyConfig, workerHostname)
+	smtpCtx, smtpSpan := tracer.Start(ctx, "smtp.check_email")
+	result, err := CheckEmail(smtpCtx, job.Email, isDevMode, proxyConfig, workerHostname, tlsPolicy)
+	for _, attempt := range resultAttempts(result) {
+		smtpSpan.AddEvent("smtp.attempt", trace.WithAttributes(
+			attribute.String("host", attempt.Host),
+			attribute.Int("code", attempt.Code),
+			attribute.String("latency", attempt.Latency.String()),
+		))
+	}
+	smtpSpan.End()
 	if err != nil {
-		log.Printf("[Worker %d] ❌ SMTP check error for %s: %v", workerID, job.Email, err)
+		log.ErrorContext(ctx, "smtp check error", "error", err)
+		rateLimiter.Penalize(domain)
 		updateEmailStatus(job.JobID, job.Email, "UNKNOWN", 0, err.Error())
+		metrics.IncEmailsProcessed("UNKNOWN", domain)
+		ackJob(ctx, token)
 		return
 	}
+	metrics.IncSMTPError(result.SMTPCode)
+
+	// AIMD feedback: a 421/45x means we're already sending faster than this
+	// domain wants; a clean 250 means it's fine with the current pace.
+	if result.SMTPCode == 421 || (result.SMTPCode >= 450 && result.SMTPCode < 460) {
+		rateLimiter.Penalize(domain)
+	} else if result.SMTPCode == 250 {
+		rateLimiter.Reward(domain)
+	}
 
 	// ============================================================
 	// FEATURE 2: GREYLISTING RETRY LOGIC
 	// ============================================================
-	// If the result is retryable (450, 451, 421), add to retry queue instead of updating DB
+	// If the result is retryable (450, 451, 421), reschedule it with an
+	// exponential-backoff+jitter delay (greylistRetryDelay) instead of
+	// updating the DB - bounded by GetSMTPCodeInfo's MaxRetries so a
+	// persistently greylisted address doesn't retry forever; once
+	// exhausted it's reported terminal-UNKNOWN instead.
 	if result.IsRetryable {
-		log.Printf("[Worker %d] ⏳ Greylisted: %s (Code: %d) - Adding to retry queue", workerID, job.Email, result.SMTPCode)
-
-		// Calculate retry timestamp (15 minutes from now)
-		retryTime := time.Now().Unix() + retryDelay
-
-		// Serialize job for ZSET
-		jobJSON, err := json.Marshal(job)
-		if err != nil {
-			log.Printf("[Worker %d] ❌ Failed to serialize job for retry queue: %v", workerID, err)
-			// Fallback: update DB with greylisted status
-			updateEmailStatus(job.JobID, job.Email, string(result.Status), result.SMTPCode, result.BounceReason)
+		if job.RetryCount >= maxGreylistRetries(result.SMTPCode) {
+			log.InfoContext(ctx, "greylist retries exhausted, reporting terminal", "smtp_code", result.SMTPCode, "retry_count", job.RetryCount)
+			updateEmailStatus(job.JobID, job.Email, string(StatusUnknown), result.SMTPCode, fmt.Sprintf("greylist retries exhausted: %s", result.BounceReason))
+			metrics.IncEmailsProcessed(string(StatusUnknown), domain)
+			ackJob(ctx, token)
 			return
 		}
 
-		// Add to Redis ZSET with score = retry timestamp
-		err = redisClient.ZAdd(ctx, retryQueue, redis.Z{
-			Score:  float64(retryTime),
-			Member: string(jobJSON),
-		}).Err()
+		job.RetryCount++
+		retryTime := time.Now().Add(greylistRetryDelay(result.SMTPCode, job.RetryCount))
+		log.InfoContext(ctx, "greylisted, scheduling retry", "smtp_code", result.SMTPCode, "retry_count", job.RetryCount, "retry_at", retryTime.Format(time.RFC3339))
 
-		if err != nil {
-			log.Printf("[Worker %d] ❌ Failed to add to retry queue: %v", workerID, err)
-			// Fallback: update DB with greylisted status
+		if err := jobQueue.Schedule(ctx, &job, retryTime); err != nil {
+			log.ErrorContext(ctx, "failed to schedule retry", "error", err)
+			// Fallback: update DB with greylisted status so the job isn't
+			// silently lost.
 			updateEmailStatus(job.JobID, job.Email, string(result.Status), result.SMTPCode, result.BounceReason)
+			metrics.IncEmailsProcessed(string(result.Status), domain)
+			ackJob(ctx, token)
 			return
 		}
-
-		fmt.Printf("[Worker %d] ⏳ Queued for retry at %s: %s\n", workerID, time.Unix(retryTime, 0).Format(time.RFC3339), job.Email)
+		// The job now lives in the retry ZSET under its own Schedule entry -
+		// ack the original reservation so it's removed from the inflight
+		// registry/PEL instead of being reaped as stuck.
+		ackJob(ctx, token)
 		return
 	}
 
 	// Not retryable - update database immediately
+	_, dbSpan := tracer.Start(ctx, "db.update_email_status")
 	err = updateEmailStatus(job.JobID, job.Email, string(result.Status), result.SMTPCode, result.BounceReason)
+	dbSpan.End()
 	if err != nil {
-		log.Printf("[Worker %d] ❌ Database update error for %s: %v", workerID, job.Email, err)
+		log.ErrorContext(ctx, "database update error", "error", err)
 		return
 	}
+	ackJob(ctx, token)
+	metrics.IncEmailsProcessed(string(result.Status), domain)
+
+	log.InfoContext(ctx, "check complete", "status", result.Status, "smtp_code", result.SMTPCode)
+}
 
-	// Print result with emoji
-	emoji := getStatusEmoji(result.Status)
-	fmt.Printf("[Worker %d] %s %s: %s (Code: %d)\n", workerID, emoji, result.Status, job.Email, result.SMTPCode)
+// resultAttempts returns result.Attempts, or nil if result itself is nil -
+// a small guard so the span-event loop in processEmail doesn't need its
+// own nil check.
+func resultAttempts(result *SMTPResult) []AttemptRecord {
+	if result == nil {
+		return nil
+	}
+	return result.Attempts
+}
+
+// ackJob acknowledges a reserved job with jobQueue, logging (rather than
+// failing the caller) on error - if this fails, the backend's own
+// reclamation (Reaper for list, XAUTOCLAIM for streams) will pick the job
+// back up, which is a safer failure mode than losing track of it here.
+func ackJob(ctx context.Context, token AckToken) {
+	if err := jobQueue.Ack(ctx, token); err != nil {
+		log.Printf("⚠️  Failed to ack completed job: %v", err)
+	}
 }
 
 // updateEmailStatus updates the EmailCheck record in PostgreSQL
@@ -400,24 +656,6 @@ func updateEmailStatus(jobID, email, status string, smtpCode int, bounceReason s
 	return err
 }
 
-// getStatusEmoji returns an emoji for the status
-func getStatusEmoji(status EmailStatus) string {
-	switch status {
-	case StatusValid:
-		return "✅"
-	case StatusInvalid:
-		return "❌"
-	case StatusGreylisted:
-		return "⏳"
-	case StatusCatchAll:
-		return "📬"
-	case StatusUnknown:
-		return "❓"
-	default:
-		return "❓"
-	}
-}
-
 // ============================================================
 // CRITICAL: STRICT EMAIL SYNTAX VALIDATION (RFC 5322 Compliant)
 // ============================================================
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ListQueue is the original Redis LIST (ready queue) + ZSET (delayed
+// retries, per-worker inflight) driver, now expressed behind the Queue
+// interface. reserveJobScript/reapRequeueScript and the Reaper goroutine
+// in joblifecycle.go are this driver's in-flight tracking.
+//
+// Since chunk1-5, the single ready queue is three priority-tiered lists
+// (queueKeys, high to low) that Reserve drains in order - see
+// priorityQueueKeys for the key mapping.
+type ListQueue struct {
+	rdb         *redis.Client
+	queueKeys   []string
+	retryKey    string
+	inflightKey string
+}
+
+// NewListQueue builds a ListQueue over the priority-tiered email_queue:*
+// lists, email_retry_queue, and a per-worker inflight ZSET.
+func NewListQueue(rdb *redis.Client, hostname string) *ListQueue {
+	queueKeys := make([]string, len(priorityOrder))
+	for i, p := range priorityOrder {
+		queueKeys[i] = priorityQueueKeys[p]
+	}
+	return &ListQueue{
+		rdb:         rdb,
+		queueKeys:   queueKeys,
+		retryKey:    retryQueue,
+		inflightKey: inflightKeyFor(hostname),
+	}
+}
+
+// listAckToken is ListQueue's AckToken: the inflight ZSET the job was
+// stamped into, plus its exact raw member value.
+type listAckToken struct {
+	inflightKey string
+	raw         string
+}
+
+func (q *ListQueue) Reserve(ctx context.Context) (*EmailJob, AckToken, error) {
+	job, raw, err := reserveJob(ctx, q.rdb, q.queueKeys, q.inflightKey)
+	if err != nil || job == nil {
+		return nil, nil, err
+	}
+	return job, listAckToken{inflightKey: q.inflightKey, raw: raw}, nil
+}
+
+func (q *ListQueue) Ack(ctx context.Context, token AckToken) error {
+	t, ok := token.(listAckToken)
+	if !ok {
+		return fmt.Errorf("ListQueue.Ack: wrong token type %T", token)
+	}
+	return q.rdb.ZRem(ctx, t.inflightKey, t.raw).Err()
+}
+
+func (q *ListQueue) Nack(ctx context.Context, token AckToken, retryAfter time.Duration) error {
+	t, ok := token.(listAckToken)
+	if !ok {
+		return fmt.Errorf("ListQueue.Nack: wrong token type %T", token)
+	}
+
+	var job EmailJob
+	if err := json.Unmarshal([]byte(t.raw), &job); err != nil {
+		return fmt.Errorf("ListQueue.Nack: failed to decode reserved job: %v", err)
+	}
+
+	if err := q.Schedule(ctx, &job, time.Now().Add(retryAfter)); err != nil {
+		return err
+	}
+	return q.rdb.ZRem(ctx, t.inflightKey, t.raw).Err()
+}
+
+func (q *ListQueue) Schedule(ctx context.Context, job *EmailJob, at time.Time) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("ListQueue.Schedule: failed to marshal job: %v", err)
+	}
+	return q.rdb.ZAdd(ctx, q.retryKey, redis.Z{
+		Score:  float64(at.Unix()),
+		Member: string(payload),
+	}).Err()
+}
+
+// PromoteDueRetries moves every job in retryKey whose due time has passed
+// back onto the ready list for its priority (see priorityQueueKeys). This is the logic RetryMonitor has always run; it now
+// lives on the driver so RetryMonitor can stay backend-agnostic.
+func (q *ListQueue) PromoteDueRetries(ctx context.Context) (int, error) {
+	now := time.Now().Unix()
+
+	items, err := q.rdb.ZRangeByScore(ctx, q.retryKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("%d", now),
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	promoted := 0
+	for _, itemJSON := range items {
+		var job EmailJob
+		if err := json.Unmarshal([]byte(itemJSON), &job); err != nil {
+			q.rdb.ZRem(ctx, q.retryKey, itemJSON)
+			continue
+		}
+
+		removed, err := q.rdb.ZRem(ctx, q.retryKey, itemJSON).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		if err := q.rdb.LPush(ctx, priorityQueueKeys[normalizePriority(job.Priority)], itemJSON).Err(); err != nil {
+			// Push failed - put it back so it isn't lost, and try again
+			// next sweep.
+			q.rdb.ZAdd(ctx, q.retryKey, redis.Z{Score: float64(now), Member: itemJSON})
+			continue
+		}
+
+		promoted++
+	}
+
+	return promoted, nil
+}
+
+// RetryQueueDepth reports how many jobs are waiting in retryKey.
+func (q *ListQueue) RetryQueueDepth(ctx context.Context) (int64, error) {
+	return q.rdb.ZCard(ctx, q.retryKey).Result()
+}
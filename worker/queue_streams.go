@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ============================================================
+// FEATURE: REDIS STREAMS CONSUMER-GROUP QUEUE DRIVER
+// ============================================================
+// StreamQueue trades the LIST+ZSET driver's custom inflight-ZSET/Reaper
+// pair for a single Redis Stream consumer group. XREADGROUP puts a claimed
+// message on the group's pending-entries list (PEL) for free, and
+// XAUTOCLAIM lets any consumer reclaim PEL entries that have sat idle past
+// jobVisibilityTimeout - so Reserve doubles as its own reaper and no
+// separate goroutine is needed for this backend.
+
+const (
+	// streamKey is the Stream jobs are read from.
+	streamKey = "email_stream"
+	// streamGroup is the consumer group every worker process shares.
+	streamGroup = "email_validator"
+	// streamRetryKey is the delayed-retry ZSET for this backend, mirroring
+	// ListQueue.retryKey since Streams has no native delayed delivery.
+	streamRetryKey = "email_stream_retry"
+	// streamBlock bounds how long XREADGROUP waits for a new message
+	// before Reserve returns "nothing available" to its caller.
+	streamBlock = 500 * time.Millisecond
+)
+
+// StreamQueue is the Redis Streams consumer-group Queue driver.
+type StreamQueue struct {
+	rdb      *redis.Client
+	stream   string
+	group    string
+	retryKey string
+	consumer string
+}
+
+// NewStreamQueue builds a StreamQueue, creating the consumer group (and the
+// stream, via MKSTREAM) if it doesn't already exist.
+func NewStreamQueue(rdb *redis.Client, hostname string) *StreamQueue {
+	q := &StreamQueue{
+		rdb:      rdb,
+		stream:   streamKey,
+		group:    streamGroup,
+		retryKey: streamRetryKey,
+		consumer: hostname,
+	}
+
+	err := rdb.XGroupCreateMkStream(context.Background(), q.stream, q.group, "0").Err()
+	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+		log.Printf("⚠️  StreamQueue: failed to create consumer group %s on %s: %v", q.group, q.stream, err)
+	}
+
+	return q
+}
+
+// streamAckToken is StreamQueue's AckToken: the message ID (for XACK) plus
+// the raw job payload (needed to re-submit it on Nack).
+type streamAckToken struct {
+	id  string
+	raw string
+}
+
+func (q *StreamQueue) Reserve(ctx context.Context) (*EmailJob, AckToken, error) {
+	// Reclaim anything abandoned by a dead consumer before reading new
+	// messages - this is the XAUTOCLAIM-based reaping that replaces a
+	// custom Reaper goroutine for this backend.
+	claimed, _, err := q.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   q.stream,
+		Group:    q.group,
+		Consumer: q.consumer,
+		MinIdle:  jobVisibilityTimeout,
+		Start:    "0",
+		Count:    1,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, nil, fmt.Errorf("StreamQueue: XAUTOCLAIM failed: %v", err)
+	}
+	if len(claimed) > 0 {
+		return q.decodeMessage(claimed[0])
+	}
+
+	streams, err := q.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    q.group,
+		Consumer: q.consumer,
+		Streams:  []string{q.stream, ">"},
+		Count:    1,
+		Block:    streamBlock,
+	}).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("StreamQueue: XREADGROUP failed: %v", err)
+	}
+	if len(streams) == 0 || len(streams[0].Messages) == 0 {
+		return nil, nil, nil
+	}
+
+	return q.decodeMessage(streams[0].Messages[0])
+}
+
+// decodeMessage unpacks the "job" field XAdd stores a job's JSON under.
+func (q *StreamQueue) decodeMessage(msg redis.XMessage) (*EmailJob, AckToken, error) {
+	raw, ok := msg.Values["job"].(string)
+	if !ok {
+		return nil, nil, fmt.Errorf("StreamQueue: message %s missing job field", msg.ID)
+	}
+
+	var job EmailJob
+	if err := json.Unmarshal([]byte(raw), &job); err != nil {
+		return nil, nil, fmt.Errorf("StreamQueue: failed to decode message %s: %v", msg.ID, err)
+	}
+
+	return &job, streamAckToken{id: msg.ID, raw: raw}, nil
+}
+
+func (q *StreamQueue) Ack(ctx context.Context, token AckToken) error {
+	t, ok := token.(streamAckToken)
+	if !ok {
+		return fmt.Errorf("StreamQueue.Ack: wrong token type %T", token)
+	}
+	return q.rdb.XAck(ctx, q.stream, q.group, t.id).Err()
+}
+
+func (q *StreamQueue) Nack(ctx context.Context, token AckToken, retryAfter time.Duration) error {
+	t, ok := token.(streamAckToken)
+	if !ok {
+		return fmt.Errorf("StreamQueue.Nack: wrong token type %T", token)
+	}
+
+	var job EmailJob
+	if err := json.Unmarshal([]byte(t.raw), &job); err != nil {
+		return fmt.Errorf("StreamQueue.Nack: failed to decode reserved job: %v", err)
+	}
+
+	if err := q.Schedule(ctx, &job, time.Now().Add(retryAfter)); err != nil {
+		return err
+	}
+	return q.rdb.XAck(ctx, q.stream, q.group, t.id).Err()
+}
+
+func (q *StreamQueue) Schedule(ctx context.Context, job *EmailJob, at time.Time) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("StreamQueue.Schedule: failed to marshal job: %v", err)
+	}
+	return q.rdb.ZAdd(ctx, q.retryKey, redis.Z{
+		Score:  float64(at.Unix()),
+		Member: string(payload),
+	}).Err()
+}
+
+// PromoteDueRetries moves every job in retryKey whose due time has passed
+// onto the stream via XADD.
+func (q *StreamQueue) PromoteDueRetries(ctx context.Context) (int, error) {
+	now := time.Now().Unix()
+
+	items, err := q.rdb.ZRangeByScore(ctx, q.retryKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("%d", now),
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	promoted := 0
+	for _, itemJSON := range items {
+		removed, err := q.rdb.ZRem(ctx, q.retryKey, itemJSON).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		err = q.rdb.XAdd(ctx, &redis.XAddArgs{
+			Stream: q.stream,
+			Values: map[string]interface{}{"job": itemJSON},
+		}).Err()
+		if err != nil {
+			q.rdb.ZAdd(ctx, q.retryKey, redis.Z{Score: float64(now), Member: itemJSON})
+			continue
+		}
+
+		promoted++
+	}
+
+	return promoted, nil
+}
+
+// RetryQueueDepth reports how many jobs are waiting in retryKey.
+func (q *StreamQueue) RetryQueueDepth(ctx context.Context) (int64, error) {
+	return q.rdb.ZCard(ctx, q.retryKey).Result()
+}
@@ -2,19 +2,99 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/redis/go-redis/v9"
 	"golang.org/x/time/rate"
 )
 
+// ============================================================
+// FEATURE: ADAPTIVE (AIMD) DOMAIN RATE LIMITING WITH PERSISTENT MEMORY
+// ============================================================
+// The static per-domain table below used to be the whole story, and it
+// forgot everything on restart. A domain returning 421/45x under load is
+// telling us our current rate is already too aggressive for it - Penalize
+// backs off multiplicatively so the next retry doesn't just repeat the
+// same mistake, and Reward claws back up additively once the domain is
+// happy again (additive-increase/multiplicative-decrease, the same shape
+// TCP congestion control uses for the same reason). The email_ratelimits
+// hash in Redis (rateLimitPersistKey) lets every worker in the fleet converge on the same politeness
+// level instead of each re-learning it the hard way after every deploy.
+
+const (
+	// domainRateFloor is the slowest Penalize will ever drive a domain's
+	// rate down to - never fully stop sending, just slow to a crawl.
+	domainRateFloor = 0.1
+	// defaultDomainRate is the ceiling assigned to domains with no
+	// explicit entry below.
+	defaultDomainRate = 5.0
+	// domainRateIncreaseStep is how much Reward adds back per success.
+	domainRateIncreaseStep = 0.1
+	// domainPenaltyCooldown keeps Reward from undoing a Penalize before it
+	// has had a chance to actually change the server's behavior.
+	domainPenaltyCooldown = 10 * time.Second
+	// defaultMaxInflightPerDomain caps concurrent in-flight SMTP checks
+	// per domain, independent of the token-bucket rate - some providers
+	// (Gmail included) trip their abuse heuristics on parallelism as much
+	// as on throughput.
+	defaultMaxInflightPerDomain = 5
+
+	// rateLimitPersistKey is the Redis hash domain rates are persisted to.
+	rateLimitPersistKey = "email_ratelimits"
+	// rateLimitPersistInterval is how often RunPersistence writes to it.
+	rateLimitPersistInterval = 30 * time.Second
+)
+
+// domainRateState is a domain's adaptive rate limiter plus the bookkeeping
+// Penalize/Reward need: how high Reward may climb back to, and when the
+// last penalty landed (Reward's cooldown check).
+type domainRateState struct {
+	limiter     *rate.Limiter
+	ceiling     float64
+	lastPenalty time.Time
+}
+
+// newDomainRateState builds a domainRateState starting at (and ceilinged
+// at) rate checks/second.
+func newDomainRateState(rateLimit float64) *domainRateState {
+	return &domainRateState{
+		limiter: rate.NewLimiter(rate.Limit(rateLimit), burstFor(rateLimit)),
+		ceiling: rateLimit,
+	}
+}
+
+// burstFor picks a token-bucket burst size for a given rate - always at
+// least 1, since rate.NewLimiter rejects a zero burst.
+func burstFor(rateLimit float64) int {
+	burst := int(rateLimit)
+	if burst < 1 {
+		burst = 1
+	}
+	return burst
+}
+
+// persistedRateState is the JSON shape stored per-domain in the
+// email_ratelimits Redis hash.
+type persistedRateState struct {
+	Rate        float64 `json:"rate"`
+	LastPenalty int64   `json:"lastPenalty"`
+}
+
 // RateLimiterManager manages global and per-domain rate limiters
 type RateLimiterManager struct {
-	globalLimiter *rate.Limiter
-	domainLimiters map[string]*rate.Limiter
-	mu            sync.RWMutex
+	globalLimiter  *rate.Limiter
+	domainLimiters map[string]*domainRateState
+	domainInflight map[string]chan struct{}
+	maxInflight    int
+	mu             sync.RWMutex
 }
 
 // NewRateLimiterManager creates a new rate limiter manager with safety limits
@@ -22,28 +102,59 @@ func NewRateLimiterManager() *RateLimiterManager {
 	// Global limit: 10 checks/second
 	globalLimiter := rate.NewLimiter(10, 10) // 10 per second, burst of 10
 
-	// Domain-specific limits
-	domainLimiters := make(map[string]*rate.Limiter)
-	
+	// Domain-specific limits (also act as each domain's Reward ceiling)
+	domainLimiters := make(map[string]*domainRateState)
+
 	// Gmail domains: 2 checks/second
-	domainLimiters["gmail.com"] = rate.NewLimiter(2, 2)
-	domainLimiters["googlemail.com"] = rate.NewLimiter(2, 2)
-	
+	domainLimiters["gmail.com"] = newDomainRateState(2)
+	domainLimiters["googlemail.com"] = newDomainRateState(2)
+
 	// Outlook domains: 1 check/second
-	domainLimiters["outlook.com"] = rate.NewLimiter(1, 1)
-	domainLimiters["hotmail.com"] = rate.NewLimiter(1, 1)
-	domainLimiters["live.com"] = rate.NewLimiter(1, 1)
-	
+	domainLimiters["outlook.com"] = newDomainRateState(1)
+	domainLimiters["hotmail.com"] = newDomainRateState(1)
+	domainLimiters["live.com"] = newDomainRateState(1)
+
 	// Yahoo: 1 check/second
-	domainLimiters["yahoo.com"] = rate.NewLimiter(1, 1)
-	
+	domainLimiters["yahoo.com"] = newDomainRateState(1)
+
 	// Default: 5 checks/second (for other domains)
 	// This will be created on-demand
 
+	maxInflight := defaultMaxInflightPerDomain
+	if v := os.Getenv("MAX_INFLIGHT_PER_DOMAIN"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			maxInflight = parsed
+		}
+	}
+
 	return &RateLimiterManager{
 		globalLimiter:  globalLimiter,
 		domainLimiters: domainLimiters,
+		domainInflight: make(map[string]chan struct{}),
+		maxInflight:    maxInflight,
+	}
+}
+
+// getOrCreateState returns domain's rate state, creating one at
+// defaultDomainRate if this is the first time domain has been seen.
+func (rlm *RateLimiterManager) getOrCreateState(domain string) *domainRateState {
+	rlm.mu.RLock()
+	state, exists := rlm.domainLimiters[domain]
+	rlm.mu.RUnlock()
+
+	if exists {
+		return state
+	}
+
+	rlm.mu.Lock()
+	defer rlm.mu.Unlock()
+	// Double-check after acquiring write lock
+	if state, exists = rlm.domainLimiters[domain]; exists {
+		return state
 	}
+	state = newDomainRateState(defaultDomainRate)
+	rlm.domainLimiters[domain] = state
+	return state
 }
 
 // Wait waits for both global and domain-specific rate limits
@@ -51,53 +162,206 @@ func NewRateLimiterManager() *RateLimiterManager {
 func (rlm *RateLimiterManager) Wait(ctx context.Context, domain string) error {
 	// Normalize domain to lowercase
 	domain = strings.ToLower(domain)
-	
+
 	// Wait for global limiter first
 	if err := rlm.globalLimiter.Wait(ctx); err != nil {
 		return err
 	}
-	
-	// Get or create domain limiter
+
+	// Wait for domain limiter (created on first use if necessary)
+	if err := rlm.getOrCreateState(domain).limiter.Wait(ctx); err != nil {
+		return err
+	}
+
+	// Log rate limit wait for sensitive domains
+	if domain == "gmail.com" || domain == "googlemail.com" ||
+		domain == "outlook.com" || domain == "hotmail.com" ||
+		domain == "live.com" || domain == "yahoo.com" {
+		log.Printf("⏳ Rate Limit Wait for [%s]", domain)
+	}
+
+	return nil
+}
+
+// Penalize multiplicatively halves domain's current rate (floored at
+// domainRateFloor) - the "multiplicative decrease" half of AIMD.
+// processEmail calls it after a 421/45x response and after a CheckEmail
+// error; a connection failure that CheckEmail reports as a code-0
+// SMTPResult does not trigger it.
+func (rlm *RateLimiterManager) Penalize(domain string) {
+	domain = strings.ToLower(domain)
+	state := rlm.getOrCreateState(domain)
+
+	rlm.mu.Lock()
+	defer rlm.mu.Unlock()
+
+	newRate := float64(state.limiter.Limit()) * 0.5
+	if newRate < domainRateFloor {
+		newRate = domainRateFloor
+	}
+	state.limiter.SetLimit(rate.Limit(newRate))
+	state.limiter.SetBurst(burstFor(newRate))
+	state.lastPenalty = time.Now()
+
+	log.Printf("🐢 Rate Limiter: penalized %s, new rate %.2f/sec", domain, newRate)
+}
+
+// Reward additively increases domain's rate back toward its configured
+// ceiling after a clean 250 - the "additive increase" half of AIMD. No-ops
+// within domainPenaltyCooldown of the last Penalize so a recovering domain
+// isn't immediately pushed back to the rate that got it penalized.
+func (rlm *RateLimiterManager) Reward(domain string) {
+	domain = strings.ToLower(domain)
+	state := rlm.getOrCreateState(domain)
+
+	rlm.mu.Lock()
+	defer rlm.mu.Unlock()
+
+	if time.Since(state.lastPenalty) < domainPenaltyCooldown {
+		return
+	}
+
+	newRate := float64(state.limiter.Limit()) + domainRateIncreaseStep
+	if newRate > state.ceiling {
+		newRate = state.ceiling
+	}
+	if newRate == float64(state.limiter.Limit()) {
+		return
+	}
+	state.limiter.SetLimit(rate.Limit(newRate))
+	state.limiter.SetBurst(burstFor(newRate))
+}
+
+// AcquireInflight blocks until domain has a free in-flight slot (capped at
+// maxInflight) or ctx is cancelled, returning a release func to call when
+// the check completes.
+func (rlm *RateLimiterManager) AcquireInflight(ctx context.Context, domain string) (func(), error) {
+	domain = strings.ToLower(domain)
+
 	rlm.mu.RLock()
-	limiter, exists := rlm.domainLimiters[domain]
+	sem, exists := rlm.domainInflight[domain]
 	rlm.mu.RUnlock()
-	
+
 	if !exists {
-		// Create default limiter (5 checks/second)
 		rlm.mu.Lock()
-		// Double-check after acquiring write lock
-		if limiter, exists = rlm.domainLimiters[domain]; !exists {
-			limiter = rate.NewLimiter(5, 5) // 5 per second, burst of 5
-			rlm.domainLimiters[domain] = limiter
+		if sem, exists = rlm.domainInflight[domain]; !exists {
+			sem = make(chan struct{}, rlm.maxInflight)
+			rlm.domainInflight[domain] = sem
 		}
 		rlm.mu.Unlock()
 	}
-	
-	// Wait for domain limiter
-	if err := limiter.Wait(ctx); err != nil {
-		return err
-	}
-	
-	// Log rate limit wait for sensitive domains
-	if domain == "gmail.com" || domain == "googlemail.com" || 
-	   domain == "outlook.com" || domain == "hotmail.com" || 
-	   domain == "live.com" || domain == "yahoo.com" {
-		log.Printf("⏳ Rate Limit Wait for [%s]", domain)
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	
-	return nil
 }
 
 // GetDomainRate returns the current rate limit for a domain (for logging)
 func (rlm *RateLimiterManager) GetDomainRate(domain string) string {
 	domain = strings.ToLower(domain)
-	
+
 	rlm.mu.RLock()
 	defer rlm.mu.RUnlock()
-	
-	if limiter, exists := rlm.domainLimiters[domain]; exists {
-		limit := limiter.Limit()
-		return fmt.Sprintf("%.1f/sec", float64(limit))
+
+	if state, exists := rlm.domainLimiters[domain]; exists {
+		return fmt.Sprintf("%.1f/sec", float64(state.limiter.Limit()))
 	}
 	return "5.0/sec (default)"
 }
+
+// PersistToRedis writes every domain's current rate and last-penalty time
+// to the email_ratelimits hash so other workers - and this one, after a
+// restart - converge on the same politeness level instead of starting
+// cold.
+func (rlm *RateLimiterManager) PersistToRedis(ctx context.Context, rdb *redis.Client) error {
+	rlm.mu.RLock()
+	fields := make(map[string]interface{}, len(rlm.domainLimiters))
+	for domain, state := range rlm.domainLimiters {
+		payload, err := json.Marshal(persistedRateState{
+			Rate:        float64(state.limiter.Limit()),
+			LastPenalty: state.lastPenalty.Unix(),
+		})
+		if err != nil {
+			continue
+		}
+		fields[domain] = string(payload)
+	}
+	rlm.mu.RUnlock()
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return rdb.HSet(ctx, rateLimitPersistKey, fields).Err()
+}
+
+// LoadFromRedis seeds domain rates from email_ratelimits on startup so a
+// freshly-started worker doesn't re-learn a domain's politeness the hard
+// way.
+func (rlm *RateLimiterManager) LoadFromRedis(ctx context.Context, rdb *redis.Client) {
+	saved, err := rdb.HGetAll(ctx, rateLimitPersistKey).Result()
+	if err != nil {
+		log.Printf("⚠️  Rate Limiter: failed to load persisted rates: %v", err)
+		return
+	}
+
+	loaded := 0
+	for domain, raw := range saved {
+		var persisted persistedRateState
+		if err := json.Unmarshal([]byte(raw), &persisted); err != nil {
+			log.Printf("⚠️  Rate Limiter: skipping corrupt persisted rate for %s: %v", domain, err)
+			continue
+		}
+
+		state := rlm.getOrCreateState(domain)
+		rlm.mu.Lock()
+		state.limiter.SetLimit(rate.Limit(persisted.Rate))
+		state.limiter.SetBurst(burstFor(persisted.Rate))
+		state.lastPenalty = time.Unix(persisted.LastPenalty, 0)
+		rlm.mu.Unlock()
+		loaded++
+	}
+
+	if loaded > 0 {
+		log.Printf("🛡️  Rate Limiter: loaded %d persisted domain rate(s)", loaded)
+	}
+}
+
+// RunPersistence periodically calls PersistToRedis until ctx is done - a
+// goroutine sibling of RetryMonitor/Reaper.
+func (rlm *RateLimiterManager) RunPersistence(ctx context.Context, rdb *redis.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := rlm.PersistToRedis(ctx, rdb); err != nil {
+				log.Printf("⚠️  Rate Limiter: failed to persist rates: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// WriteMetrics writes the current per-domain rate limit and in-flight
+// count in Prometheus text exposition format.
+func (rlm *RateLimiterManager) WriteMetrics(w io.Writer) {
+	rlm.mu.RLock()
+	defer rlm.mu.RUnlock()
+
+	fmt.Fprintln(w, "# HELP email_validator_domain_rate_limit Current allowed rate (checks/sec) per domain after AIMD adjustment.")
+	fmt.Fprintln(w, "# TYPE email_validator_domain_rate_limit gauge")
+	for domain, state := range rlm.domainLimiters {
+		fmt.Fprintf(w, "email_validator_domain_rate_limit{domain=%q} %.4f\n", domain, float64(state.limiter.Limit()))
+	}
+
+	fmt.Fprintln(w, "# HELP email_validator_domain_inflight Current in-flight SMTP checks per domain.")
+	fmt.Fprintln(w, "# TYPE email_validator_domain_inflight gauge")
+	for domain, sem := range rlm.domainInflight {
+		fmt.Fprintf(w, "email_validator_domain_inflight{domain=%q} %d\n", domain, len(sem))
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// FEATURE: IP REPUTATION / DNSBL PRE-FLIGHT
+// ============================================================
+// Before dialing the target MX (when not routing through a proxy), check
+// whether our own egress IP is already burned: listed on a DNSBL, or its
+// reverse DNS doesn't match the HELO name we're about to present. Probing
+// from a listed/mismatched IP just gets 550'd and further damages our
+// sending reputation, so it's cheaper to short-circuit first.
+
+// defaultDNSBLs are consulted by ReputationCheck. Order doesn't matter -
+// any hit marks the IP listed.
+var defaultDNSBLs = []string{
+	"zen.spamhaus.org",
+	"dnsbl.sorbs.net",
+	"b.barracudacentral.org",
+}
+
+// ReputationReport is the result of a ReputationCheck.
+type ReputationReport struct {
+	EgressIP              string
+	HeloName              string
+	Listed                bool
+	ListedOn              []string
+	ReverseDNS            string
+	ReverseDNSMatchesHelo bool
+	SPFRecord             string
+	Diagnostic            string
+}
+
+// ReputationCheck looks up egressIP against defaultDNSBLs and checks
+// whether its reverse DNS matches heloName (the name we're about to
+// present in HELO/EHLO), plus the SPF record for heloName. It's exposed
+// standalone so it can be reused outside CheckEmail (e.g. a startup
+// self-check or a periodic health probe).
+func ReputationCheck(ctx context.Context, egressIP, heloName string) (*ReputationReport, error) {
+	ip := net.ParseIP(egressIP)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid egress IP: %s", egressIP)
+	}
+
+	report := &ReputationReport{EgressIP: egressIP, HeloName: heloName}
+
+	reversed, err := reverseIPv4ForDNSBL(ip)
+	if err != nil {
+		log.Printf("⚠️  DNSBL lookup skipped for %s: %v", egressIP, err)
+	} else {
+		for _, dnsbl := range defaultDNSBLs {
+			query := fmt.Sprintf("%s.%s", reversed, dnsbl)
+			if addrs, lookupErr := net.DefaultResolver.LookupHost(ctx, query); lookupErr == nil && len(addrs) > 0 {
+				report.Listed = true
+				report.ListedOn = append(report.ListedOn, dnsbl)
+			}
+			// Any other error (NXDOMAIN, timeout) means "not listed" for
+			// that DNSBL - this is a best-effort signal, not a hard gate.
+		}
+	}
+
+	if names, lookupErr := net.DefaultResolver.LookupAddr(ctx, egressIP); lookupErr == nil && len(names) > 0 {
+		report.ReverseDNS = strings.TrimSuffix(names[0], ".")
+		report.ReverseDNSMatchesHelo = strings.EqualFold(report.ReverseDNS, heloName)
+	}
+
+	if records, lookupErr := net.DefaultResolver.LookupTXT(ctx, heloName); lookupErr == nil {
+		for _, record := range records {
+			if strings.HasPrefix(record, "v=spf1") {
+				report.SPFRecord = record
+				break
+			}
+		}
+	}
+
+	var diagnostics []string
+	if report.Listed {
+		diagnostics = append(diagnostics, fmt.Sprintf("egress IP listed on: %s", strings.Join(report.ListedOn, ", ")))
+	}
+	if report.ReverseDNS != "" && !report.ReverseDNSMatchesHelo {
+		diagnostics = append(diagnostics, fmt.Sprintf("rDNS %s does not match HELO name %s", report.ReverseDNS, heloName))
+	}
+	report.Diagnostic = strings.Join(diagnostics, "; ")
+
+	return report, nil
+}
+
+// reverseIPv4ForDNSBL reverses the octets of an IPv4 address for DNSBL
+// zone queries (e.g. 1.2.3.4 -> 4.3.2.1.zone). IPv6 DNSBL lookups use a
+// different (nibble-reversed) format and aren't supported here.
+func reverseIPv4ForDNSBL(ip net.IP) (string, error) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return "", fmt.Errorf("IPv6 DNSBL lookups are not supported")
+	}
+	return fmt.Sprintf("%d.%d.%d.%d", ip4[3], ip4[2], ip4[1], ip4[0]), nil
+}
+
+// detectEgressIP determines the local IP address that would be used to
+// reach the public internet, by opening a UDP "connection" (no packets
+// are actually sent) to a well-known address and reading back the chosen
+// local address.
+func detectEgressIP() (string, error) {
+	conn, err := net.DialTimeout("udp", "8.8.8.8:80", 2*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine egress IP: %v", err)
+	}
+	defer conn.Close()
+
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return "", fmt.Errorf("unexpected local address type %T", conn.LocalAddr())
+	}
+	return addr.IP.String(), nil
+}
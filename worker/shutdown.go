@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ============================================================
+// FEATURE: GRACEFUL SHUTDOWN WITH IN-FLIGHT DRAIN
+// ============================================================
+// Without this, a SIGTERM (e.g. `kubectl rollout restart`) killed the
+// process mid-deployment and took every in-flight SMTP check and any
+// buffered-but-unstarted job down with it. installShutdownHandler cancels
+// the shared context on the first SIGINT/SIGTERM so every select in the
+// worker (main loop, RetryMonitor, Reaper, rate limiter persistence) can
+// unblock and exit; main then closes jobChan, waits up to
+// SHUTDOWN_GRACE_PERIOD for workerWG to drain, and finally requeues
+// whatever is still listed in inflightRegistry so another worker picks it
+// up.
+
+// defaultShutdownGracePeriod is how long main waits for in-flight jobs to
+// finish before forcibly requeuing whatever's left and exiting.
+const defaultShutdownGracePeriod = 30 * time.Second
+
+// workerWG tracks jobs that have been dispatched to jobChan but not yet
+// fully processed (queued in the channel buffer, or actively being worked).
+// main waits on it during shutdown to know when it's safe to exit.
+var workerWG sync.WaitGroup
+
+// inflightRegistry maps a job's ID to the AckToken needed to return it to
+// the queue, for every job currently dispatched to a worker. It exists
+// purely for shutdown: if the grace period expires with workers still
+// busy, requeueStrandedJobs walks it and hands every remaining job back.
+var (
+	inflightRegistry   = make(map[string]AckToken)
+	inflightRegistryMu sync.Mutex
+)
+
+// trackInflight registers jobID/token as dispatched to a worker.
+func trackInflight(jobID string, token AckToken) {
+	inflightRegistryMu.Lock()
+	inflightRegistry[jobID] = token
+	inflightRegistryMu.Unlock()
+}
+
+// untrackInflight removes jobID once it has been acked, nacked, or
+// otherwise finally handled by a worker.
+func untrackInflight(jobID string) {
+	inflightRegistryMu.Lock()
+	delete(inflightRegistry, jobID)
+	inflightRegistryMu.Unlock()
+}
+
+// installShutdownHandler cancels cancel on the first SIGINT/SIGTERM so
+// every ctx-aware loop in the process can exit promptly, and force-exits
+// the process on a second signal in case something is stuck ignoring ctx.
+func installShutdownHandler(cancel context.CancelFunc) {
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigCh
+		log.Printf("🛑 Received %s - starting graceful shutdown", sig)
+		cancel()
+
+		sig = <-sigCh
+		log.Printf("🛑 Received second %s - forcing immediate exit", sig)
+		os.Exit(1)
+	}()
+}
+
+// shutdownGracePeriod reads SHUTDOWN_GRACE_PERIOD (seconds) from the
+// environment, falling back to defaultShutdownGracePeriod.
+func shutdownGracePeriod() time.Duration {
+	v := os.Getenv("SHUTDOWN_GRACE_PERIOD")
+	if v == "" {
+		return defaultShutdownGracePeriod
+	}
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs <= 0 {
+		log.Printf("⚠️  Invalid SHUTDOWN_GRACE_PERIOD=%q, using default %s", v, defaultShutdownGracePeriod)
+		return defaultShutdownGracePeriod
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// drainWorkers closes jobChan (so every worker's range loop exits once it
+// finishes its current job) and waits up to gracePeriod for workerWG to
+// reach zero. It returns true if everything drained cleanly.
+func drainWorkers(jobChan chan inflightJob, gracePeriod time.Duration) bool {
+	close(jobChan)
+
+	done := make(chan struct{})
+	go func() {
+		workerWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(gracePeriod):
+		return false
+	}
+}
+
+// requeueStrandedJobs hands every job still listed in inflightRegistry back
+// to the queue (retry-able immediately, retryAfter=0) so another worker
+// picks it up. Uses a background context since the shared one is already
+// cancelled by the time this runs.
+func requeueStrandedJobs() {
+	inflightRegistryMu.Lock()
+	defer inflightRegistryMu.Unlock()
+
+	for jobID, token := range inflightRegistry {
+		if err := jobQueue.Nack(context.Background(), token, 0); err != nil {
+			log.Printf("⚠️  Shutdown: failed to requeue stranded job %s: %v", jobID, err)
+			continue
+		}
+		log.Printf("🔁 Shutdown: requeued stranded job %s", jobID)
+		delete(inflightRegistry, jobID)
+	}
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"crypto/rand"
+	"crypto/tls"
 	"fmt"
 	"log"
+	"math"
 	"math/big"
 	"net"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/net/proxy"
@@ -30,6 +37,23 @@ type SMTPResult struct {
 	SMTPCode     int
 	BounceReason string
 	IsRetryable  bool // True if this should be retried (450, 451, 421)
+	Attempts     []AttemptRecord // Per-MX-host attempt trail, ordered by Pref
+	EnhancedCode string          // RFC 3463 enhanced status code (x.y.z), if present
+	ResponseText string          // Full (possibly multi-line) response text for the final command
+	TLS          TLSInfo         // STARTTLS upgrade outcome, if one was attempted
+	CatchAllConfidence float64       // [0,1] confidence that the domain is catch-all, from checkCatchAll
+	ProbeDetails       []ProbeDetail // Per-probe outcomes backing CatchAllConfidence
+}
+
+// AttemptRecord captures the outcome of a single MX host attempt so callers
+// can see exactly which hosts were tried and why we fell through to the next
+// one (connection refused, greylist, etc.) instead of only seeing the final
+// verdict.
+type AttemptRecord struct {
+	Host    string
+	Code    int
+	Latency time.Duration
+	Error   string
 }
 
 // ProxyConfig contains SOCKS5 proxy configuration
@@ -44,26 +68,27 @@ type ProxyConfig struct {
 // 2. Catch-all detection via random probe
 // 3. Greylisting detection (returns IsRetryable flag)
 // 4. Proper SMTP identity using WORKER_HOSTNAME
-func CheckEmail(ctx context.Context, email string, isDevMode bool, proxyConfig *ProxyConfig, workerHostname string) (*SMTPResult, error) {
+// 5. MX fallback - walks the full MX list (by Pref) instead of only mxRecords[0]
+func CheckEmail(ctx context.Context, email string, isDevMode bool, proxyConfig *ProxyConfig, workerHostname string, tlsPolicy TLSPolicy) (*SMTPResult, error) {
 	// Extract domain from email
 	parts := strings.Split(email, "@")
 	if len(parts) != 2 {
 		return &SMTPResult{
-			Status:      StatusInvalid,
-			SMTPCode:    550,
+			Status:       StatusInvalid,
+			SMTPCode:     550,
 			BounceReason: "Invalid email format",
-			IsRetryable: false,
+			IsRetryable:  false,
 		}, nil
 	}
 
 	domain := parts[1]
 
-	var mailServer string
+	var mxHosts []string
 	var port string
 
 	if isDevMode {
 		// DEV MODE: Skip DNS lookup, use MailHog directly
-		mailServer = "localhost"
+		mxHosts = []string{"localhost"}
 		port = "1025"
 	} else {
 		// ============================================================
@@ -73,7 +98,7 @@ func CheckEmail(ctx context.Context, email string, isDevMode bool, proxyConfig *
 		// CRITICAL: If MX lookup fails or returns empty, mark as INVALID immediately
 		// Do NOT proceed to SMTP checks
 		mxRecords, err := net.LookupMX(domain)
-		
+
 		// Check for lookup errors
 		if err != nil {
 			log.Printf("❌ MX lookup failed for domain %s: %v", domain, err)
@@ -96,8 +121,23 @@ func CheckEmail(ctx context.Context, email string, isDevMode bool, proxyConfig *
 			}, nil
 		}
 
-		// Validate MX record hostname is not empty
-		if mxRecords[0].Host == "" || strings.TrimSpace(mxRecords[0].Host) == "" {
+		// ============================================================
+		// FEATURE: MX FALLBACK (sorted by Pref, not just mxRecords[0])
+		// ============================================================
+		// A single dead/greylisting/blocking MX host used to sink the whole
+		// check to UNKNOWN even when a lower-priority host would answer.
+		// Sort ascending by Pref (RFC 5321 lowest-preference-first) and try
+		// every host in order.
+		sort.Slice(mxRecords, func(i, j int) bool { return mxRecords[i].Pref < mxRecords[j].Pref })
+
+		for _, mx := range mxRecords {
+			host := strings.TrimSuffix(strings.TrimSpace(mx.Host), ".")
+			if host != "" {
+				mxHosts = append(mxHosts, host)
+			}
+		}
+
+		if len(mxHosts) == 0 {
 			log.Printf("❌ Invalid MX record (empty hostname) for domain %s", domain)
 			return &SMTPResult{
 				Status:       StatusInvalid,
@@ -107,41 +147,162 @@ func CheckEmail(ctx context.Context, email string, isDevMode bool, proxyConfig *
 			}, nil
 		}
 
-		// Use the first MX record
-		mailServer = strings.TrimSuffix(mxRecords[0].Host, ".")
 		port = "25"
-		
-		// Final validation: mailServer must not be empty after trimming
-		if mailServer == "" {
-			log.Printf("❌ Invalid MX record (empty after trim) for domain %s", domain)
+	}
+
+	// ============================================================
+	// FEATURE: IP REPUTATION / DNSBL PRE-FLIGHT
+	// ============================================================
+	// When connecting directly (no proxy), check our own egress IP before
+	// burning a probe that will likely get 550'd - and may further harm
+	// our sending reputation - on an IP that's already listed on a DNSBL.
+	// The rDNS/HELO match is also checked, but only disqualifies the probe
+	// when requireRDNSMatch is set: in most real deployments (NAT,
+	// Kubernetes pod names, shared egress IPs) the egress IP's reverse DNS
+	// legitimately won't equal WORKER_HOSTNAME, so treating that mismatch
+	// as disqualifying by default would fail every check closed.
+	if !isDevMode && (proxyConfig == nil || proxyConfig.Address == "") {
+		if egressIP, ipErr := detectEgressIP(); ipErr != nil {
+			log.Printf("⚠️  Reputation pre-flight skipped, could not determine egress IP: %v", ipErr)
+		} else if report, repErr := ReputationCheck(ctx, egressIP, workerHostname); repErr != nil {
+			log.Printf("⚠️  Reputation pre-flight failed: %v", repErr)
+		} else if report.Listed || (requireRDNSMatch && report.ReverseDNS != "" && !report.ReverseDNSMatchesHelo) {
+			log.Printf("❌ Reputation pre-flight failed for %s: %s", egressIP, report.Diagnostic)
 			return &SMTPResult{
-				Status:       StatusInvalid,
-				SMTPCode:     550,
-				BounceReason: "Invalid MX record (empty hostname after processing)",
+				Status:       StatusUnknown,
+				SMTPCode:     0,
+				BounceReason: fmt.Sprintf("Reputation pre-flight failed: %s", report.Diagnostic),
 				IsRetryable:  false,
 			}, nil
 		}
 	}
 
 	// ============================================================
-	// FEATURE 3: CATCH-ALL DETECTION (Random Probe)
+	// FEATURE: PROVIDER-SPECIFIC VERIFICATION BACKENDS
+	// ============================================================
+	// Some providers block or lie to generic SMTP RCPT probes. If a
+	// registered backend claims the resolved (highest-priority) MX host,
+	// dispatch to it instead of the generic SMTP conversation below.
+	if !isDevMode && len(mxHosts) > 0 {
+		if backend := findBackend(mxHosts[0]); backend != nil {
+			result, err := backend.Check(ctx, email)
+			if err != nil {
+				return nil, err
+			}
+			if result != nil {
+				result.Attempts = []AttemptRecord{{Host: mxHosts[0], Code: result.SMTPCode, Error: result.BounceReason}}
+			}
+			return result, nil
+		}
+	}
+
+	// ============================================================
+	// FEATURE 3: CATCH-ALL DETECTION (Multi-Probe, Confidence-Scored)
 	// ============================================================
-	// Before validating the actual email, probe with a random address
-	// to detect catch-all domains
+	// Before validating the actual email, send several structurally
+	// distinct probes to detect catch-all domains. Walks the same MX
+	// fallback list, and caches the per-domain verdict.
+	var catchAllProbe ProbeResult
 	if !isDevMode {
-		probeResult := checkCatchAll(mailServer, port, domain, proxyConfig, workerHostname)
-		if probeResult.IsCatchAll {
+		catchAllProbe = checkCatchAll(mxHosts, port, domain, proxyConfig, workerHostname)
+		if catchAllProbe.IsCatchAll {
 			// Domain is catch-all - mark original email as CATCH_ALL immediately
 			return &SMTPResult{
-				Status:       StatusCatchAll,
-				SMTPCode:     250, // Catch-all accepts all addresses
-				BounceReason: "Catch-all domain detected via probe",
-				IsRetryable: false,
+				Status:           StatusCatchAll,
+				SMTPCode:         250, // Catch-all accepts all addresses
+				BounceReason:     "Catch-all domain detected via probe",
+				IsRetryable:      false,
+				CatchAllConfidence: catchAllProbe.Confidence,
+				ProbeDetails:       catchAllProbe.ProbeDetails,
 			}, nil
 		}
-		// If probe returned 550, domain is normal - proceed with real validation
+		// Not catch-all (or inconclusive) - proceed with real validation
+	}
+
+	// Attempt each MX host in order until one gives a definitive verdict
+	// (250, or any permanent 5xx - see isDefinitiveCode). Connection errors
+	// and 4xx responses fall through to the next host instead of
+	// terminating the check.
+	var attempts []AttemptRecord
+	var lastResult *SMTPResult
+
+	for _, mailServer := range mxHosts {
+		start := time.Now()
+		result, err := attemptSMTPHost(ctx, email, mailServer, port, proxyConfig, workerHostname, isDevMode, tlsPolicy)
+		latency := time.Since(start)
+
+		if err != nil {
+			// Shouldn't normally happen - attemptSMTPHost reports failures
+			// via SMTPResult, not error, but guard anyway. A bare
+			// connection error carries no information beyond "couldn't
+			// reach this host" - never let it mask a real verdict (even a
+			// retryable greylist) an earlier host already gave us.
+			attempts = append(attempts, AttemptRecord{Host: mailServer, Code: 0, Latency: latency, Error: err.Error()})
+			if lastResult == nil || lastResult.SMTPCode == 0 {
+				lastResult = &SMTPResult{Status: StatusUnknown, SMTPCode: 0, BounceReason: err.Error(), IsRetryable: false}
+			}
+			continue
+		}
+
+		attemptErr := ""
+		if result.Status == StatusUnknown {
+			attemptErr = result.BounceReason
+		}
+		attempts = append(attempts, AttemptRecord{Host: mailServer, Code: result.SMTPCode, Latency: latency, Error: attemptErr})
+
+		switch {
+		case lastResult == nil:
+			lastResult = result
+		case lastResult.IsRetryable && !result.IsRetryable && !isDefinitiveCode(result.SMTPCode):
+			// A retryable greylist verdict from an earlier, reachable host
+			// is strictly more actionable than this host's non-definitive
+			// non-retryable response (e.g. a bare connection error, or an
+			// unrecognized code) - keep it rather than downgrading to
+			// "report UNKNOWN, don't retry".
+		default:
+			lastResult = result
+		}
+
+		if isDefinitiveCode(result.SMTPCode) {
+			// Permanent 5xx or a clean 250 - this is final, do not try
+			// another MX host (mirrors how MTAs like chasquid stop
+			// falling back once a host gives a real answer).
+			break
+		}
+		// Connection errors (Status == StatusUnknown, code 0) and 4xx
+		// (greylisted) fall through to the next MX host.
+	}
+
+	lastResult.Attempts = attempts
+	lastResult.CatchAllConfidence = catchAllProbe.Confidence
+	lastResult.ProbeDetails = catchAllProbe.ProbeDetails
+	return lastResult, nil
+}
+
+// isDefinitiveCode reports whether an SMTP code is a final verdict that
+// should stop MX fallback (accept or hard bounce), as opposed to a
+// connection failure or temporary failure that's worth retrying on the
+// next MX host.
+func isDefinitiveCode(code int) bool {
+	switch {
+	case code == 250:
+		return true
+	case code >= 500 && code < 600:
+		// Any permanent 5xx is a hard bounce, not just 550/551/553 -
+		// 500/552/554 and friends are just as final (the greylist switch
+		// in attemptSMTPHost also maps every 5xx to INVALID), so MX
+		// fallback must stop here too.
+		return true
+	default:
+		return false
 	}
+}
 
+// attemptSMTPHost runs the full SMTP conversation (connect, EHLO with HELO
+// fallback, optional STARTTLS, MAIL FROM, RCPT TO) against a single MX host and returns the resulting verdict for
+// that host alone. CheckEmail drives this in a loop across the MX fallback
+// list.
+func attemptSMTPHost(ctx context.Context, email, mailServer, port string, proxyConfig *ProxyConfig, workerHostname string, isDevMode bool, tlsPolicy TLSPolicy) (*SMTPResult, error) {
 	// ============================================================
 	// FEATURE 2: SOCKS5 PROXY SUPPORT (Fail-Safe, No Fallback)
 	// ============================================================
@@ -149,112 +310,210 @@ func CheckEmail(ctx context.Context, email string, isDevMode bool, proxyConfig *
 	conn, err := connectWithProxy(ctx, mailServer, port, proxyConfig, isDevMode)
 	if err != nil {
 		// FAIL-SAFE: If proxy connection fails, mark as UNKNOWN (do not fallback)
-		log.Printf("❌ Proxy connection failed for %s: %v", domain, err)
+		log.Printf("❌ Proxy connection failed for %s: %v", mailServer, err)
 		return &SMTPResult{
-			Status:      StatusUnknown,
-			SMTPCode:    0,
+			Status:       StatusUnknown,
+			SMTPCode:     0,
 			BounceReason: fmt.Sprintf("Connection failed: %v", err),
-			IsRetryable: false,
+			IsRetryable:  false,
 		}, nil
 	}
-	defer conn.Close()
+	// conn is captured by reference here (not conn.Close() bound
+	// immediately) because STARTTLS below reassigns conn to the TLS-wrapped
+	// connection, and we want the deferred Close to close whichever one is
+	// live when this function returns.
+	defer func() { conn.Close() }()
 
 	// Log successful proxy connection
 	if proxyConfig != nil && proxyConfig.Address != "" && !isDevMode {
-		log.Printf("⚡ Connected via Proxy to [%s]", domain)
+		log.Printf("⚡ Connected via Proxy to [%s]", mailServer)
 	}
 
 	// Set read/write timeout
 	conn.SetDeadline(time.Now().Add(10 * time.Second))
 
+	reader := bufio.NewReader(conn)
+
 	// Read initial greeting
-	buffer := make([]byte, 512)
-	n, err := conn.Read(buffer)
+	code, _, _, raw, err := readSMTPResponse(reader)
 	if err != nil {
 		return &SMTPResult{
-			Status:      StatusUnknown,
-			SMTPCode:    0,
+			Status:       StatusUnknown,
+			SMTPCode:     0,
 			BounceReason: fmt.Sprintf("Failed to read greeting: %v", err),
-			IsRetryable: false,
+			IsRetryable:  false,
 		}, nil
 	}
-
-	response := string(buffer[:n])
-	code := parseSMTPCode(response)
 	if code != 220 {
 		return &SMTPResult{
-			Status:      StatusUnknown,
-			SMTPCode:    code,
-			BounceReason: fmt.Sprintf("Server greeting error: %s", response),
-			IsRetryable: false,
+			Status:       StatusUnknown,
+			SMTPCode:     code,
+			BounceReason: fmt.Sprintf("Server greeting error: %s", raw),
+			IsRetryable:  false,
 		}, nil
 	}
 
 	// ============================================================
-	// FEATURE 3: PROPER SMTP IDENTITY (WORKER_HOSTNAME)
+	// FEATURE 3: PROPER SMTP IDENTITY (WORKER_HOSTNAME) + STARTTLS
 	// ============================================================
-	// Send HELO with proper worker hostname (never localhost/127.0.0.1)
-	heloCmd := fmt.Sprintf("HELO %s\r\n", workerHostname)
-	_, err = conn.Write([]byte(heloCmd))
+	// Send EHLO (not HELO) so the server advertises its capability list,
+	// including STARTTLS.
+	ehloCmd := fmt.Sprintf("EHLO %s\r\n", workerHostname)
+	_, err = conn.Write([]byte(ehloCmd))
 	if err != nil {
 		return &SMTPResult{
-			Status:      StatusUnknown,
-			SMTPCode:    0,
-			BounceReason: fmt.Sprintf("Failed to send HELO: %v", err),
-			IsRetryable: false,
+			Status:       StatusUnknown,
+			SMTPCode:     0,
+			BounceReason: fmt.Sprintf("Failed to send EHLO: %v", err),
+			IsRetryable:  false,
 		}, nil
 	}
 
-	n, err = conn.Read(buffer)
+	code, _, ehloLines, raw, err := readSMTPResponse(reader)
 	if err != nil {
 		return &SMTPResult{
-			Status:      StatusUnknown,
-			SMTPCode:    0,
-			BounceReason: fmt.Sprintf("Failed to read HELO response: %v", err),
-			IsRetryable: false,
+			Status:       StatusUnknown,
+			SMTPCode:     0,
+			BounceReason: fmt.Sprintf("Failed to read EHLO response: %v", err),
+			IsRetryable:  false,
 		}, nil
 	}
-
-	response = string(buffer[:n])
-	code = parseSMTPCode(response)
 	if code != 250 {
+		// Some ancient servers don't understand EHLO at all - fall back to
+		// HELO, but without a capability list there's nothing to upgrade.
+		heloCmd := fmt.Sprintf("HELO %s\r\n", workerHostname)
+		if _, err := conn.Write([]byte(heloCmd)); err != nil {
+			return &SMTPResult{
+				Status:       StatusUnknown,
+				SMTPCode:     0,
+				BounceReason: fmt.Sprintf("Failed to send HELO: %v", err),
+				IsRetryable:  false,
+			}, nil
+		}
+		code, _, _, raw, err = readSMTPResponse(reader)
+		if err != nil {
+			return &SMTPResult{
+				Status:       StatusUnknown,
+				SMTPCode:     0,
+				BounceReason: fmt.Sprintf("Failed to read HELO response: %v", err),
+				IsRetryable:  false,
+			}, nil
+		}
+		if code != 250 {
+			return &SMTPResult{
+				Status:       StatusUnknown,
+				SMTPCode:     code,
+				BounceReason: fmt.Sprintf("HELO error: %s", raw),
+				IsRetryable:  false,
+			}, nil
+		}
+		ehloLines = nil
+	}
+
+	var tlsInfo TLSInfo
+	tlsInfo.DANEStatus = "not-checked"
+
+	starttlsOffered := false
+	for _, line := range ehloLines {
+		if len(line) > 4 && strings.EqualFold(strings.TrimSpace(line[4:]), "STARTTLS") {
+			starttlsOffered = true
+			break
+		}
+	}
+
+	if tlsPolicy == TLSRequired && !starttlsOffered {
 		return &SMTPResult{
-			Status:      StatusUnknown,
-			SMTPCode:    code,
-			BounceReason: fmt.Sprintf("HELO error: %s", response),
-			IsRetryable: false,
+			Status:       StatusUnknown,
+			SMTPCode:     0,
+			BounceReason: "TLS required but server did not advertise STARTTLS",
+			IsRetryable:  false,
+			TLS:          tlsInfo,
 		}, nil
 	}
 
+	if starttlsOffered {
+		upgraded, upgradeErr := startTLS(conn, reader, mailServer)
+		if upgradeErr != nil {
+			if tlsPolicy == TLSRequired {
+				return &SMTPResult{
+					Status:       StatusUnknown,
+					SMTPCode:     0,
+					BounceReason: fmt.Sprintf("STARTTLS upgrade failed: %v", upgradeErr),
+					IsRetryable:  false,
+					TLS:          tlsInfo,
+				}, nil
+			}
+			// Opportunistic: log and carry on in plaintext over the
+			// existing connection/session.
+			log.Printf("⚠️  STARTTLS upgrade failed for %s, continuing in plaintext: %v", mailServer, upgradeErr)
+		} else {
+			conn = upgraded.conn
+			reader = upgraded.reader
+			tlsInfo = upgraded.info
+
+			// RFC 3207: the client MUST discard any prior EHLO state and
+			// re-issue EHLO inside the new TLS session.
+			_, err = conn.Write([]byte(ehloCmd))
+			if err != nil {
+				return &SMTPResult{
+					Status:       StatusUnknown,
+					SMTPCode:     0,
+					BounceReason: fmt.Sprintf("Failed to send post-STARTTLS EHLO: %v", err),
+					IsRetryable:  false,
+					TLS:          tlsInfo,
+				}, nil
+			}
+			code, _, _, raw, err = readSMTPResponse(reader)
+			if err != nil {
+				return &SMTPResult{
+					Status:       StatusUnknown,
+					SMTPCode:     0,
+					BounceReason: fmt.Sprintf("Failed to read post-STARTTLS EHLO response: %v", err),
+					IsRetryable:  false,
+					TLS:          tlsInfo,
+				}, nil
+			}
+			if code != 250 {
+				return &SMTPResult{
+					Status:       StatusUnknown,
+					SMTPCode:     code,
+					BounceReason: fmt.Sprintf("Post-STARTTLS EHLO error: %s", raw),
+					IsRetryable:  false,
+					TLS:          tlsInfo,
+				}, nil
+			}
+		}
+	}
+
 	// Send MAIL FROM
 	_, err = conn.Write([]byte("MAIL FROM:<check@yourdomain.com>\r\n"))
 	if err != nil {
 		return &SMTPResult{
-			Status:      StatusUnknown,
-			SMTPCode:    0,
+			Status:       StatusUnknown,
+			SMTPCode:     0,
 			BounceReason: fmt.Sprintf("Failed to send MAIL FROM: %v", err),
-			IsRetryable: false,
+			IsRetryable:  false,
+			TLS:          tlsInfo,
 		}, nil
 	}
 
-	n, err = conn.Read(buffer)
+	code, _, _, raw, err = readSMTPResponse(reader)
 	if err != nil {
 		return &SMTPResult{
-			Status:      StatusUnknown,
-			SMTPCode:    0,
+			Status:       StatusUnknown,
+			SMTPCode:     0,
 			BounceReason: fmt.Sprintf("Failed to read MAIL FROM response: %v", err),
-			IsRetryable: false,
+			IsRetryable:  false,
+			TLS:          tlsInfo,
 		}, nil
 	}
-
-	response = string(buffer[:n])
-	code = parseSMTPCode(response)
 	if code != 250 {
 		return &SMTPResult{
-			Status:      StatusUnknown,
-			SMTPCode:    code,
-			BounceReason: fmt.Sprintf("MAIL FROM error: %s", response),
-			IsRetryable: false,
+			Status:       StatusUnknown,
+			SMTPCode:     code,
+			BounceReason: fmt.Sprintf("MAIL FROM error: %s", raw),
+			IsRetryable:  false,
+			TLS:          tlsInfo,
 		}, nil
 	}
 
@@ -263,26 +522,27 @@ func CheckEmail(ctx context.Context, email string, isDevMode bool, proxyConfig *
 	_, err = conn.Write([]byte(rcptCmd))
 	if err != nil {
 		return &SMTPResult{
-			Status:      StatusUnknown,
-			SMTPCode:    0,
+			Status:       StatusUnknown,
+			SMTPCode:     0,
 			BounceReason: fmt.Sprintf("Failed to send RCPT TO: %v", err),
-			IsRetryable: false,
+			IsRetryable:  false,
+			TLS:          tlsInfo,
 		}, nil
 	}
 
-	n, err = conn.Read(buffer)
+	var enhancedCode string
+	var lines []string
+	code, enhancedCode, lines, raw, err = readSMTPResponse(reader)
 	if err != nil {
 		return &SMTPResult{
-			Status:      StatusUnknown,
-			SMTPCode:    0,
+			Status:       StatusUnknown,
+			SMTPCode:     0,
 			BounceReason: fmt.Sprintf("Failed to read RCPT TO response: %v", err),
-			IsRetryable: false,
+			IsRetryable:  false,
+			TLS:          tlsInfo,
 		}, nil
 	}
-
-	response = string(buffer[:n])
-	code = parseSMTPCode(response)
-	bounceReason := strings.TrimSpace(response[4:]) // Remove the code and space
+	bounceReason := bounceReasonFromLines(lines)
 
 	// ============================================================
 	// FEATURE 2: GREYLISTING DETECTION
@@ -304,8 +564,9 @@ func CheckEmail(ctx context.Context, email string, isDevMode bool, proxyConfig *
 		// Greylisted or temporary failure - RETRYABLE
 		status = StatusGreylisted
 		isRetryable = true // Mark for retry queue
-	case code == 550 || code == 551 || code == 553:
-		// Invalid (permanent failure)
+	case code >= 500 && code < 600:
+		// Any permanent 5xx is a hard bounce (not just 550/551/553) - see
+		// isDefinitiveCode.
 		status = StatusInvalid
 		isRetryable = false
 	default:
@@ -316,16 +577,131 @@ func CheckEmail(ctx context.Context, email string, isDevMode bool, proxyConfig *
 
 	// Send QUIT (do not send DATA)
 	conn.Write([]byte("QUIT\r\n"))
-	conn.Read(buffer) // Read QUIT response (ignore errors)
+	readSMTPResponse(reader) // Read QUIT response (ignore errors)
 
 	return &SMTPResult{
 		Status:       status,
 		SMTPCode:     code,
 		BounceReason: bounceReason,
 		IsRetryable:  isRetryable,
+		EnhancedCode: enhancedCode,
+		ResponseText: raw,
+		TLS:          tlsInfo,
 	}, nil
 }
 
+// tlsUpgrade bundles the artifacts of a successful STARTTLS handshake:
+// the new net.Conn (a *tls.Conn), a bufio.Reader wrapping it, and the
+// TLSInfo describing what was negotiated.
+type tlsUpgrade struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	info   TLSInfo
+}
+
+// startTLS sends STARTTLS on an already-open SMTP connection and, if the
+// server agrees (220), performs the TLS handshake with ServerName set to
+// mailServer so certificate validation matches what the MX record claims
+// to be.
+func startTLS(conn net.Conn, reader *bufio.Reader, mailServer string) (*tlsUpgrade, error) {
+	if _, err := conn.Write([]byte("STARTTLS\r\n")); err != nil {
+		return nil, fmt.Errorf("failed to send STARTTLS: %v", err)
+	}
+
+	code, _, _, raw, err := readSMTPResponse(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read STARTTLS response: %v", err)
+	}
+	if code != 220 {
+		return nil, fmt.Errorf("STARTTLS rejected: %s", raw)
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: mailServer})
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("TLS handshake failed: %v", err)
+	}
+
+	state := tlsConn.ConnectionState()
+	info := TLSInfo{
+		Used:        true,
+		Version:     state.Version,
+		CipherSuite: state.CipherSuite,
+		DANEStatus:  "not-checked",
+	}
+	if len(state.PeerCertificates) > 0 {
+		info.PeerCertSubject = state.PeerCertificates[0].Subject.String()
+	}
+
+	return &tlsUpgrade{
+		conn:   tlsConn,
+		reader: bufio.NewReader(tlsConn),
+		info:   info,
+	}, nil
+}
+
+// enhancedCodePattern matches an RFC 3463 enhanced status code (x.y.z) at
+// the start of an SMTP response line's text, e.g. "550 5.1.1 ...".
+var enhancedCodePattern = regexp.MustCompile(`^\d{3}[ -](\d\.\d{1,3}\.\d{1,3})\b`)
+
+// readSMTPResponse reads a (possibly multi-line) SMTP reply per RFC 5321
+// §4.2.1: continuation lines use "code-text", the final line uses
+// "code text". It returns the numeric code, any RFC 3463 enhanced status
+// code found in the text, each line (without CRLF), and the raw joined
+// response.
+func readSMTPResponse(reader *bufio.Reader) (code int, enhancedCode string, lines []string, raw string, err error) {
+	for {
+		line, rerr := reader.ReadString('\n')
+		if rerr != nil && line == "" {
+			return 0, "", nil, "", rerr
+		}
+
+		trimmed := strings.TrimRight(line, "\r\n")
+		lines = append(lines, trimmed)
+
+		if len(trimmed) < 4 {
+			// Malformed line - nothing more we can safely parse
+			break
+		}
+
+		if c, perr := strconv.Atoi(trimmed[:3]); perr == nil {
+			code = c
+		}
+
+		if enhancedCode == "" {
+			if m := enhancedCodePattern.FindStringSubmatch(trimmed); m != nil {
+				enhancedCode = m[1]
+			}
+		}
+
+		// "code " (space) marks the final line of the reply; "code-" marks
+		// a continuation line that's followed by at least one more.
+		if trimmed[3] == ' ' {
+			break
+		}
+		if rerr != nil {
+			break
+		}
+	}
+
+	raw = strings.Join(lines, "\r\n")
+	return code, enhancedCode, lines, raw, nil
+}
+
+// bounceReasonFromLines joins multi-line SMTP reply text (stripped of the
+// leading "code " / "code-" prefix on each line) into a single
+// human-readable bounce reason.
+func bounceReasonFromLines(lines []string) string {
+	texts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if len(line) > 4 {
+			texts = append(texts, strings.TrimSpace(line[4:]))
+		} else if len(line) > 0 {
+			texts = append(texts, strings.TrimSpace(line))
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
 // ============================================================
 // FEATURE 2: SOCKS5 PROXY CONNECTION (With Authentication)
 // ============================================================
@@ -392,72 +768,194 @@ func connectWithProxy(ctx context.Context, mailServer, port string, proxyConfig
 }
 
 // ============================================================
-// FEATURE 3: CATCH-ALL DETECTION (Random Probe)
+// FEATURE 6: MULTI-PROBE ADAPTIVE CATCH-ALL DETECTION
 // ============================================================
-// ProbeResult contains the result of a catch-all probe
+// A single random RCPT used to treat any 2xx as definitive catch-all,
+// which produces false positives (servers that 250 the first RCPT then
+// bounce asynchronously) and false negatives (servers that tarpit
+// per-address). checkCatchAll instead sends several structurally distinct
+// probes in one SMTP session and scores a confidence instead of a bool.
+
+// defaultCatchAllProbeCount is how many distinct probe addresses
+// checkCatchAll sends per domain.
+const defaultCatchAllProbeCount = 3
+
+// catchAllCacheTTL is how long a per-domain catch-all verdict is reused
+// before checkCatchAll probes again.
+const catchAllCacheTTL = 30 * time.Minute
+
+// catchAllAcceptThreshold is the minimum confidence to call a domain
+// catch-all outright.
+const catchAllAcceptThreshold = 0.66
+
+// ProbeDetail captures the outcome of a single catch-all probe address.
+type ProbeDetail struct {
+	LocalPart string
+	Code      int
+	Accepted  bool
+}
+
+// ProbeResult contains the result of a catch-all probe round.
 type ProbeResult struct {
-	IsCatchAll bool
-	SMTPCode   int
+	IsCatchAll   bool
+	SMTPCode     int
+	Confidence   float64
+	ProbeDetails []ProbeDetail
 }
 
-// checkCatchAll performs a probe check with a random email address
-// to detect if the domain is a catch-all
-func checkCatchAll(mailServer, port, domain string, proxyConfig *ProxyConfig, workerHostname string) ProbeResult {
-	// Generate a random, impossible email address for this domain
-	// Format: randomstring@domain.com (e.g., d8s7f6g8s7df@example.com)
-	randomString := generateRandomString(15)
-	probeEmail := fmt.Sprintf("%s@%s", randomString, domain)
+type catchAllCacheEntry struct {
+	result    ProbeResult
+	expiresAt time.Time
+}
 
-	// Connect to mail server
-	ctx := context.Background()
-	conn, err := connectWithProxy(ctx, mailServer, port, proxyConfig, false)
-	if err != nil {
-		// Connection failed - can't determine catch-all, assume normal
-		return ProbeResult{IsCatchAll: false, SMTPCode: 0}
+var (
+	catchAllCache   = make(map[string]catchAllCacheEntry)
+	catchAllCacheMu sync.RWMutex
+)
+
+// checkCatchAll sends defaultCatchAllProbeCount structurally distinct
+// probe addresses in a single SMTP session (multiple RCPT TO under one
+// MAIL FROM) to detect if the domain is a catch-all, and caches the
+// per-domain verdict for catchAllCacheTTL. Like CheckEmail, it walks the
+// MX fallback list in order.
+func checkCatchAll(mxHosts []string, port, domain string, proxyConfig *ProxyConfig, workerHostname string) ProbeResult {
+	if cached, ok := getCachedCatchAll(domain); ok {
+		return cached
 	}
-	defer conn.Close()
 
-	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	probeLocalParts := buildCatchAllProbeAddresses(defaultCatchAllProbeCount)
+	ctx := context.Background()
 
-	// Perform minimal SMTP handshake for probe
-	buffer := make([]byte, 512)
+	for _, mailServer := range mxHosts {
+		conn, err := connectWithProxy(ctx, mailServer, port, proxyConfig, false)
+		if err != nil {
+			// Connection failed on this host - try the next MX host
+			continue
+		}
 
-	// Read greeting
-	conn.Read(buffer)
+		conn.SetDeadline(time.Now().Add(15 * time.Second))
+		reader := bufio.NewReader(conn)
 
-	// Send HELO with proper hostname
-	heloCmd := fmt.Sprintf("HELO %s\r\n", workerHostname)
-	conn.Write([]byte(heloCmd))
-	conn.Read(buffer)
+		// Read greeting
+		readSMTPResponse(reader)
 
-	// Send MAIL FROM
-	conn.Write([]byte("MAIL FROM:<check@yourdomain.com>\r\n"))
-	conn.Read(buffer)
+		// Send HELO with proper hostname
+		heloCmd := fmt.Sprintf("HELO %s\r\n", workerHostname)
+		conn.Write([]byte(heloCmd))
+		readSMTPResponse(reader)
 
-	// Send RCPT TO with random probe email
-	rcptCmd := fmt.Sprintf("RCPT TO:<%s>\r\n", probeEmail)
-	conn.Write([]byte(rcptCmd))
+		// Send MAIL FROM
+		conn.Write([]byte("MAIL FROM:<check@yourdomain.com>\r\n"))
+		readSMTPResponse(reader)
 
-	n, err := conn.Read(buffer)
-	if err != nil {
-		return ProbeResult{IsCatchAll: false, SMTPCode: 0}
+		// Send each probe as its own RCPT TO within the same session
+		var details []ProbeDetail
+		for _, localPart := range probeLocalParts {
+			rcptCmd := fmt.Sprintf("RCPT TO:<%s@%s>\r\n", localPart, domain)
+			conn.Write([]byte(rcptCmd))
+
+			code, _, _, _, err := readSMTPResponse(reader)
+			if err != nil {
+				// Connection dropped mid-probe - whatever we collected so
+				// far is all we get from this host.
+				break
+			}
+			details = append(details, ProbeDetail{
+				LocalPart: localPart,
+				Code:      code,
+				Accepted:  code == 250 || code == 251 || code == 252,
+			})
+		}
+
+		// Send QUIT
+		conn.Write([]byte("QUIT\r\n"))
+		readSMTPResponse(reader)
+		conn.Close()
+
+		if len(details) == 0 {
+			// Nothing usable from this host - try the next MX host
+			continue
+		}
+
+		result := scoreCatchAllProbes(details)
+		cacheCatchAll(domain, result)
+		return result
 	}
 
-	response := string(buffer[:n])
-	code := parseSMTPCode(response)
+	// No MX host produced usable probes - assume normal rather than risk
+	// a false catch-all positive
+	return ProbeResult{IsCatchAll: false, SMTPCode: 0, Confidence: 0}
+}
 
-	// Send QUIT
-	conn.Write([]byte("QUIT\r\n"))
-	conn.Read(buffer)
+// buildCatchAllProbeAddresses generates up to count structurally distinct
+// probe local-parts: a long random string, a plausible human-looking
+// name, and a role-like address, in that order.
+func buildCatchAllProbeAddresses(count int) []string {
+	candidates := []string{
+		generateRandomString(24),
+		fmt.Sprintf("john.smith.qa%s", generateRandomString(4)),
+		fmt.Sprintf("postmaster-test-%s", generateRandomString(6)),
+	}
+	if count >= len(candidates) {
+		return candidates
+	}
+	return candidates[:count]
+}
+
+// scoreCatchAllProbes turns a set of probe outcomes into a confidence
+// score in [0,1]: the fraction of probes accepted, boosted when any probe
+// got a 252 ("VRFY-accept"), which GetSMTPCodeInfo already flags as a
+// strong catch-all indicator.
+func scoreCatchAllProbes(details []ProbeDetail) ProbeResult {
+	accepted := 0
+	strongIndicator := false
+	lastCode := 0
+
+	for _, d := range details {
+		if d.Accepted {
+			accepted++
+		}
+		if info := GetSMTPCodeInfo(d.Code); info != nil && info.CatchallIndicator == "strong" {
+			strongIndicator = true
+		}
+		lastCode = d.Code
+	}
+
+	confidence := float64(accepted) / float64(len(details))
+	if strongIndicator {
+		confidence = math.Min(1.0, confidence+0.25)
+	}
+
+	return ProbeResult{
+		IsCatchAll:   confidence >= catchAllAcceptThreshold,
+		SMTPCode:     lastCode,
+		Confidence:   confidence,
+		ProbeDetails: details,
+	}
+}
+
+// getCachedCatchAll returns a still-fresh cached catch-all verdict for
+// domain, if one exists.
+func getCachedCatchAll(domain string) (ProbeResult, bool) {
+	catchAllCacheMu.RLock()
+	defer catchAllCacheMu.RUnlock()
 
-	// Decision Tree:
-	// - If probe returns 250 OK: Domain is CATCH-ALL (accepts random address)
-	// - If probe returns 550: Domain is normal (rejects random address)
-	if code == 250 || code == 251 || code == 252 {
-		return ProbeResult{IsCatchAll: true, SMTPCode: code}
+	entry, ok := catchAllCache[domain]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return ProbeResult{}, false
 	}
+	return entry.result, true
+}
+
+// cacheCatchAll stores a catch-all verdict for domain for catchAllCacheTTL.
+func cacheCatchAll(domain string, result ProbeResult) {
+	catchAllCacheMu.Lock()
+	defer catchAllCacheMu.Unlock()
 
-	return ProbeResult{IsCatchAll: false, SMTPCode: code}
+	catchAllCache[domain] = catchAllCacheEntry{
+		result:    result,
+		expiresAt: time.Now().Add(catchAllCacheTTL),
+	}
 }
 
 // generateRandomString creates a random alphanumeric string of specified length
@@ -471,13 +969,3 @@ func generateRandomString(length int) string {
 	return string(b)
 }
 
-// parseSMTPCode extracts the 3-digit SMTP code from a response
-func parseSMTPCode(response string) int {
-	if len(response) < 3 {
-		return 0
-	}
-
-	var code int
-	fmt.Sscanf(response[:3], "%d", &code)
-	return code
-}
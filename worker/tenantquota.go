@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ============================================================
+// FEATURE: PER-TENANT/API-KEY QUOTA WITH THROTTLED REQUEUE
+// ============================================================
+// The Postgres schema already keys EmailCheck by jobId and expects a
+// multi-tenant SaaS in front of it, but nothing enforced a cap per
+// tenant/API key - one noisy tenant could burn the whole fleet's global
+// and per-domain rate budget. TenantQuotaManager adds a Redis
+// sliding-window counter per tenant (separate per-minute and per-day
+// windows) with limits loaded from Postgres, refreshed periodically so a
+// plan change takes effect without a worker restart. A tenant over quota
+// isn't dropped or retried immediately against a window that hasn't reset
+// - its job moves to tenant_throttled:{tenant}, a delayed ZSET exactly
+// like RetryMonitor's, and comes back once the window rolls over.
+
+const (
+	// defaultTenantPerMinuteQuota/defaultTenantPerDayQuota are the caps
+	// applied to a tenant with no explicit TenantQuota row in Postgres.
+	defaultTenantPerMinuteQuota = 60
+	defaultTenantPerDayQuota    = 5000
+
+	// tenantQuotaRefreshInterval is how often LoadQuotas re-reads limits
+	// from Postgres.
+	tenantQuotaRefreshInterval = 60 * time.Second
+
+	// tenantThrottledKeyPrefix namespaces the per-tenant delayed-retry
+	// ZSETs so PromoteDueThrottled can find all of them with one SCAN.
+	tenantThrottledKeyPrefix = "tenant_throttled:"
+
+	// tenantThrottleCheckInterval is how often RunThrottleMonitor sweeps
+	// every tenant_throttled:* ZSET for due jobs.
+	tenantThrottleCheckInterval = 30 * time.Second
+)
+
+// TenantQuota is one tenant's per-minute and per-day request caps, as
+// loaded from the TenantQuota Postgres table.
+type TenantQuota struct {
+	TenantID  string
+	PerMinute int
+	PerDay    int
+}
+
+// TenantQuotaManager enforces per-tenant/API-key quotas with a
+// Redis-backed sliding-window counter, and re-enqueues over-quota jobs
+// onto a per-tenant delayed ZSET instead of dropping them.
+type TenantQuotaManager struct {
+	rdb   *redis.Client
+	db    *sql.DB
+	queue Queue
+
+	mu     sync.RWMutex
+	quotas map[string]TenantQuota
+}
+
+// NewTenantQuotaManager builds a TenantQuotaManager with no quotas loaded
+// yet - call LoadQuotas before relying on non-default limits. queue is the
+// active Queue backend - PromoteDueThrottled hands due jobs back through
+// it rather than assuming a LIST-based backend.
+func NewTenantQuotaManager(rdb *redis.Client, db *sql.DB, queue Queue) *TenantQuotaManager {
+	return &TenantQuotaManager{
+		rdb:    rdb,
+		db:     db,
+		queue:  queue,
+		quotas: make(map[string]TenantQuota),
+	}
+}
+
+// quotaFor returns tenantID's configured quota, or the defaults if
+// tenantID has no TenantQuota row.
+func (m *TenantQuotaManager) quotaFor(tenantID string) TenantQuota {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if q, ok := m.quotas[tenantID]; ok {
+		return q
+	}
+	return TenantQuota{TenantID: tenantID, PerMinute: defaultTenantPerMinuteQuota, PerDay: defaultTenantPerDayQuota}
+}
+
+// LoadQuotas (re)reads every tenant's per-minute/per-day caps from the
+// TenantQuota table and atomically swaps them in.
+func (m *TenantQuotaManager) LoadQuotas(ctx context.Context) error {
+	rows, err := m.db.QueryContext(ctx, `SELECT "tenantId", "perMinuteLimit", "perDayLimit" FROM "TenantQuota"`)
+	if err != nil {
+		return fmt.Errorf("TenantQuotaManager: failed to query TenantQuota: %v", err)
+	}
+	defer rows.Close()
+
+	loaded := make(map[string]TenantQuota)
+	for rows.Next() {
+		var q TenantQuota
+		if err := rows.Scan(&q.TenantID, &q.PerMinute, &q.PerDay); err != nil {
+			log.Printf("⚠️  TenantQuotaManager: skipping malformed TenantQuota row: %v", err)
+			continue
+		}
+		loaded[q.TenantID] = q
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("TenantQuotaManager: error reading TenantQuota rows: %v", err)
+	}
+
+	m.mu.Lock()
+	m.quotas = loaded
+	m.mu.Unlock()
+	return nil
+}
+
+// RunRefresh periodically calls LoadQuotas until ctx is done - a goroutine
+// sibling of RateLimiterManager.RunPersistence.
+func (m *TenantQuotaManager) RunRefresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.LoadQuotas(ctx); err != nil {
+				log.Printf("⚠️  TenantQuotaManager: refresh failed, keeping previous quotas: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// minuteQuotaKey/dayQuotaKey name the sliding-window counters: INCR'd by
+// Allow and left to expire naturally, so a quiet tenant's
+// window simply vanishes instead of needing active cleanup.
+func minuteQuotaKey(tenantID string, at time.Time) string {
+	return fmt.Sprintf("quota:%s:%d", tenantID, at.Unix()/60)
+}
+
+func dayQuotaKey(tenantID string, at time.Time) string {
+	return fmt.Sprintf("quota:%s:day:%s", tenantID, at.UTC().Format("2006-01-02"))
+}
+
+// Allow increments tenantID's per-minute counter and, only while that
+// window is within quota, its per-day counter, and reports whether the job
+// may proceed now. A job with no TenantID is exempt (pre-
+// quota jobs, or internal/system checks). If either window is over quota
+// it returns false with how long until that window rolls over.
+func (m *TenantQuotaManager) Allow(ctx context.Context, tenantID string) (bool, time.Duration, error) {
+	if tenantID == "" {
+		return true, 0, nil
+	}
+
+	quota := m.quotaFor(tenantID)
+	now := time.Now()
+
+	minuteKey := minuteQuotaKey(tenantID, now)
+	minuteCount, err := m.rdb.Incr(ctx, minuteKey).Result()
+	if err != nil {
+		return false, 0, fmt.Errorf("TenantQuotaManager: failed to increment %s: %v", minuteKey, err)
+	}
+	if minuteCount == 1 {
+		m.rdb.Expire(ctx, minuteKey, 70*time.Second)
+	}
+	if int(minuteCount) > quota.PerMinute {
+		resetAt := now.Truncate(time.Minute).Add(time.Minute)
+		return false, resetAt.Sub(now), nil
+	}
+
+	dayKey := dayQuotaKey(tenantID, now)
+	dayCount, err := m.rdb.Incr(ctx, dayKey).Result()
+	if err != nil {
+		return false, 0, fmt.Errorf("TenantQuotaManager: failed to increment %s: %v", dayKey, err)
+	}
+	if dayCount == 1 {
+		m.rdb.Expire(ctx, dayKey, 25*time.Hour)
+	}
+	if int(dayCount) > quota.PerDay {
+		resetAt := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return false, resetAt.Sub(now), nil
+	}
+
+	return true, 0, nil
+}
+
+// Throttle re-enqueues job onto its tenant's delayed ZSET so it becomes
+// reservable again once the exceeded window resets.
+func (m *TenantQuotaManager) Throttle(ctx context.Context, job *EmailJob, retryAfter time.Duration) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("TenantQuotaManager: failed to marshal job: %v", err)
+	}
+	return m.rdb.ZAdd(ctx, tenantThrottledKeyPrefix+job.TenantID, redis.Z{
+		Score:  float64(time.Now().Add(retryAfter).Unix()),
+		Member: string(payload),
+	}).Err()
+}
+
+// PromoteDueThrottled moves every job in every tenant_throttled:* ZSET
+// whose retry-after has elapsed back into circulation via m.queue,
+// returning how many were promoted.
+func (m *TenantQuotaManager) PromoteDueThrottled(ctx context.Context) (int, error) {
+	promoted := 0
+	var cursor uint64
+	for {
+		keys, next, err := m.rdb.Scan(ctx, cursor, tenantThrottledKeyPrefix+"*", 100).Result()
+		if err != nil {
+			return promoted, fmt.Errorf("TenantQuotaManager: SCAN failed: %v", err)
+		}
+
+		for _, key := range keys {
+			n, err := m.promoteDueForKey(ctx, key)
+			if err != nil {
+				log.Printf("⚠️  TenantQuotaManager: failed to promote %s: %v", key, err)
+				continue
+			}
+			promoted += n
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return promoted, nil
+		}
+	}
+}
+
+// promoteDueForKey promotes every due member of one tenant_throttled:*
+// ZSET by handing it back to m.queue.Schedule as due now (the backend's
+// retry ZSET, which RetryMonitor moves to the ready queue on its next
+// sweep), rather than LPUSHing onto a LIST backend's ready queue directly - with
+// QUEUE_BACKEND=streams nothing reads those lists, so a hardcoded LPush
+// would silently strand the job.
+func (m *TenantQuotaManager) promoteDueForKey(ctx context.Context, key string) (int, error) {
+	now := time.Now().Unix()
+
+	items, err := m.rdb.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("%d", now),
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	promoted := 0
+	for _, raw := range items {
+		var job EmailJob
+		if err := json.Unmarshal([]byte(raw), &job); err != nil {
+			m.rdb.ZRem(ctx, key, raw)
+			continue
+		}
+
+		removed, err := m.rdb.ZRem(ctx, key, raw).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		if err := m.queue.Schedule(ctx, &job, time.Now()); err != nil {
+			// Schedule failed - put it back so it isn't lost, and try
+			// again next sweep.
+			m.rdb.ZAdd(ctx, key, redis.Z{Score: float64(now), Member: raw})
+			continue
+		}
+		promoted++
+	}
+
+	return promoted, nil
+}
+
+// RunThrottleMonitor periodically promotes due tenant_throttled entries
+// until ctx is done - a goroutine sibling of RetryMonitor.
+func (m *TenantQuotaManager) RunThrottleMonitor(ctx context.Context) {
+	ticker := time.NewTicker(tenantThrottleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			promoted, err := m.PromoteDueThrottled(ctx)
+			if err != nil {
+				log.Printf("⚠️  TenantQuotaManager: error promoting due throttled jobs: %v", err)
+				continue
+			}
+			if promoted > 0 {
+				log.Printf("🔓 Promoted %d throttled job(s) back to queue after quota reset", promoted)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+// ============================================================
+// FEATURE: STARTTLS UPGRADE AND TLS METADATA
+// ============================================================
+// The SMTP conversation used to be plaintext-only, which several strict
+// receiving MTAs (Google/Microsoft among them) rate-limit or treat with
+// suspicion. attemptSMTPHost now issues EHLO, parses the capability list,
+// and upgrades to STARTTLS when advertised.
+
+// TLSPolicy controls how attemptSMTPHost behaves when the remote server
+// does not advertise or complete STARTTLS.
+type TLSPolicy int
+
+const (
+	// TLSOpportunistic upgrades to TLS when advertised but falls back to
+	// plaintext if STARTTLS isn't offered or the handshake fails.
+	TLSOpportunistic TLSPolicy = iota
+	// TLSRequired fails the check (does not fall back to plaintext) if
+	// STARTTLS isn't advertised or the handshake fails.
+	TLSRequired
+)
+
+// TLSInfo captures what happened during the (attempted) STARTTLS upgrade
+// on an SMTP connection.
+type TLSInfo struct {
+	Used            bool
+	Version         uint16
+	CipherSuite     uint16
+	PeerCertSubject string
+	// DANEStatus is reserved for a future DNSSEC/TLSA (DANE) lookup -
+	// not yet implemented, always "not-checked" today.
+	DANEStatus string
+}